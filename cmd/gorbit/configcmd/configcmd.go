@@ -0,0 +1,167 @@
+package configcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"text/tabwriter"
+
+	"gorbit/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configDir string
+	env       string
+)
+
+var Cmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and validate Gorbit configuration",
+	Long: `Validate, print and compare the effective configuration built from
+the configuration directory, GORBIT_* environment variables and the
+selected profile, or export its JSON Schema.`,
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration and exit non-zero on errors",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(config.WithConfigDir(configDir), config.WithEnv(env))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Configuration for %q is valid\n", cfg.App.Env)
+		return nil
+	},
+}
+
+var printCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration with secrets masked",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(config.WithConfigDir(configDir), config.WithEnv(env), config.SkipValidation())
+		if err != nil {
+			return err
+		}
+
+		settings := cfg.Redacted()
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+		for _, key := range sortedKeys(settings) {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", key, formatValue(settings[key]), cfg.Source(key))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if err := config.Validate(cfg); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "\n%v\n", err)
+		}
+		return nil
+	},
+}
+
+var diffEnvs []string
+
+var diffCmd = &cobra.Command{
+	Use:   "diff --env <a> --env <b>",
+	Short: "Show the keys that differ between two profiles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(diffEnvs) != 2 {
+			return errors.New("diff needs exactly two --env flags")
+		}
+
+		var settings [2]map[string]any
+		var cfgs [2]*config.Config
+		for i, e := range diffEnvs {
+			cfg, err := config.LoadConfig(config.WithConfigDir(configDir), config.WithEnv(e), config.SkipValidation())
+			if err != nil {
+				return fmt.Errorf("%s: %w", e, err)
+			}
+			cfgs[i] = cfg
+			settings[i] = cfg.Redacted()
+		}
+
+		// Compare the real values so changed secrets show up, masked
+		raw := [2]map[string]any{cfgs[0].Settings(), cfgs[1].Settings()}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "KEY\t%s\t%s\n", diffEnvs[0], diffEnvs[1])
+		differences := 0
+		for _, key := range sortedKeys(raw[0]) {
+			if reflect.DeepEqual(raw[0][key], raw[1][key]) {
+				continue
+			}
+			differences++
+			fmt.Fprintf(w, "%s\t%s\t%s\n", key, formatValue(settings[0][key]), formatValue(settings[1][key]))
+		}
+		if differences == 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "No differences between %s and %s\n", diffEnvs[0], diffEnvs[1])
+			return nil
+		}
+		return w.Flush()
+	},
+}
+
+var schemaOutput string
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Export a JSON Schema for the files in configs/",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var out io.Writer = cmd.OutOrStdout()
+		if schemaOutput != "" {
+			f, err := os.Create(schemaOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(config.JSONSchema())
+	},
+}
+
+func init() {
+	Cmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "configuration directory (default $"+config.ConfigDirEnv+" or ./"+config.DefaultConfigDir+")")
+
+	for _, c := range []*cobra.Command{validateCmd, printCmd} {
+		c.Flags().StringVar(&env, "env", "", "configuration profile (default $"+config.EnvVar+" or app.env)")
+	}
+	diffCmd.Flags().StringArrayVar(&diffEnvs, "env", nil, "profile to compare; pass exactly twice")
+	schemaCmd.Flags().StringVarP(&schemaOutput, "output", "o", "", "write the schema to a file instead of stdout")
+
+	Cmd.AddCommand(validateCmd, printCmd, diffCmd, schemaCmd)
+	for _, c := range Cmd.Commands() {
+		c.SilenceUsage = true
+	}
+}
+
+func sortedKeys(settings map[string]any) []string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v any) string {
+	if s, ok := v.(string); ok && s == "" {
+		return `""`
+	}
+	return fmt.Sprint(v)
+}
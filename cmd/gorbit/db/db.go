@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"gorbit/internal/config"
+	"gorbit/internal/database"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configDir  string
+	env        string
+	seedsDir   string
+	storeNames []string
+	reset      bool
+	force      bool
+)
+
+var Cmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the data in the configured datastores",
+}
+
+var seedCmd = &cobra.Command{
+	Use:   "seed [set]",
+	Short: "Load a named set of fixtures into the datastores",
+	Long: `Load the fixtures of a seed set (default "demo") from seeds/<set>/<store>
+into every enabled datastore with fixtures in it. Each .yaml or .json file
+holds the rows of the table or collection it is named after, either as a
+list or under "rows" with the identifying columns under "key":
+
+  # seeds/demo/postgres/users.yaml
+  key: [email]
+  rows:
+    - email: ada@example.com
+      name: Ada
+
+SQL tables are loaded in one transaction, referenced tables first. Rows
+with a key are upserted, MongoDB documents are upserted by _id unless a
+key is given. --reset empties the seeded tables and collections first.
+
+Seeding is refused outside the development and test profiles unless
+--force is given.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		set := "demo"
+		if len(args) > 0 {
+			set = args[0]
+		}
+
+		cfg, err := config.LoadConfig(config.WithConfigDir(configDir), config.WithEnv(env))
+		if err != nil {
+			return err
+		}
+		if !cfg.IsDevelopment() && !force {
+			return fmt.Errorf("refusing to seed the %s environment; pass --force to seed it anyway", cfg.App.Env)
+		}
+
+		dir := filepath.Join(seedsDir, set)
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("seed set %q: %w", set, err)
+		}
+		drivers, err := selectDrivers(cfg, dir)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		opts := database.SeedOptions{Reset: reset}
+		for _, d := range drivers {
+			if err := seed(ctx, cmd, cfg, d, filepath.Join(dir, d.Name), opts); err != nil {
+				return fmt.Errorf("%s: %w", d.Name, err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	Cmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "configuration directory (default $"+config.ConfigDirEnv+" or ./"+config.DefaultConfigDir+")")
+	Cmd.PersistentFlags().StringVar(&env, "env", "", "configuration profile (default $"+config.EnvVar+" or app.env)")
+
+	seedCmd.Flags().StringVar(&seedsDir, "dir", database.DefaultSeedsDir, "directory of the seed sets")
+	seedCmd.Flags().StringSliceVar(&storeNames, "store", nil, "datastores to seed (default: every enabled one with fixtures)")
+	seedCmd.Flags().BoolVar(&reset, "reset", false, "empty the seeded tables and collections first")
+	seedCmd.Flags().BoolVar(&force, "force", false, "seed outside the development and test profiles")
+
+	Cmd.AddCommand(seedCmd)
+	for _, c := range Cmd.Commands() {
+		c.SilenceUsage = true
+	}
+}
+
+// selectDrivers returns the drivers named with --store, or the enabled ones
+// with fixtures in dir.
+func selectDrivers(cfg *config.Config, dir string) ([]database.Driver, error) {
+	byName := make(map[string]database.Driver)
+	for _, d := range database.Drivers() {
+		byName[d.Name] = d
+	}
+
+	var selected []database.Driver
+	if len(storeNames) > 0 {
+		for _, name := range storeNames {
+			d, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("%q is not a datastore of this service", name)
+			}
+			if !d.Enabled(cfg) {
+				return nil, fmt.Errorf("%s is disabled in the configuration", name)
+			}
+			selected = append(selected, d)
+		}
+		return selected, nil
+	}
+
+	for _, d := range database.Drivers() {
+		if _, err := os.Stat(filepath.Join(dir, d.Name)); err == nil && d.Enabled(cfg) {
+			selected = append(selected, d)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no enabled datastore has fixtures in " + dir)
+	}
+	return selected, nil
+}
+
+func seed(ctx context.Context, cmd *cobra.Command, cfg *config.Config, d database.Driver, dir string, opts database.SeedOptions) error {
+	store, err := d.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close(context.Background())
+
+	results, err := database.SeedStore(ctx, d.Name, store, dir, opts)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %s: %d rows\n", r.Store, r.Name, r.Rows)
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: no fixtures in %s\n", d.Name, dir)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dir   string
+	store string
+	force bool
+)
+
+var Cmd = &cobra.Command{
+	Use:     "generate",
+	Aliases: []string{"g"},
+	Short:   "Generate code in a Gorbit service",
+}
+
+var resourceCmd = &cobra.Command{
+	Use:   "resource <Name> [field:type[:optional]]...",
+	Short: "Generate a domain type, repository, CRUD handlers and routes",
+	Long: `Generate a resource backed by the given datastore:
+
+  internal/domain/<name>.go                the domain type
+  internal/repository/<name>.go            a GORM or MongoDB repository
+  internal/api/v1/handlers/<name>.go       CRUD handlers with request validation
+  internal/api/v1/handlers/<name>_test.go  handler tests
+  migrations/<store>/<version>_create_<table>.{up,down}.sql  (SQL stores)
+
+and register its routes in internal/api/v1/routes.go. Existing files and
+route registrations are left alone, so the command can be re-run safely;
+use --force to overwrite the files.
+
+Field types: ` + strings.Join(FieldTypes(), ", ") + `. Fields are required
+unless marked optional, e.g. description:text:optional.`,
+	Example:      `  gorbit generate resource Product name:string price:decimal --store postgres`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		res, err := NewResource(args[0], args[1:], store)
+		if err != nil {
+			return err
+		}
+
+		changes, err := res.Generate(dir, force)
+		for _, c := range changes {
+			fmt.Fprintf(cmd.OutOrStdout(), "%-8s %s\n", c.Action, c.Path)
+		}
+		return err
+	},
+}
+
+func init() {
+	resourceCmd.Flags().StringVar(&store, "store", "", "datastore backing the resource: "+strings.Join(Stores(), ", "))
+	resourceCmd.Flags().StringVarP(&dir, "dir", "d", ".", "root directory of the service")
+	resourceCmd.Flags().BoolVar(&force, "force", false, "overwrite existing files")
+	resourceCmd.MarkFlagRequired("store")
+
+	Cmd.AddCommand(resourceCmd)
+}
@@ -0,0 +1,424 @@
+package generate
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").ParseFS(templateFS, "templates/*.tmpl"))
+
+// storeKind describes how a datastore is reached from RegisterRoutes.
+type storeKind struct {
+	// driver is the database package constant naming a SQL driver
+	driver string
+	mongo  bool
+}
+
+var storeKinds = map[string]storeKind{
+	"mysql":    {driver: "MySQLDriver"},
+	"postgres": {driver: "PostgresDriver"},
+	"mongodb":  {mongo: true},
+}
+
+// Stores returns the datastores a resource can be generated for, sorted.
+func Stores() []string {
+	names := make([]string, 0, len(storeKinds))
+	for name := range storeKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type fieldType struct {
+	goType   string
+	postgres string
+	mysql    string
+	// sample is a JSON-compatible Go literal used by the generated tests
+	sample string
+}
+
+var fieldTypes = map[string]fieldType{
+	"string":  {"string", "VARCHAR(255)", "VARCHAR(255)", `"example"`},
+	"text":    {"string", "TEXT", "TEXT", `"example"`},
+	"int":     {"int", "INTEGER", "INT", "1"},
+	"int64":   {"int64", "BIGINT", "BIGINT", "1"},
+	"float":   {"float64", "DOUBLE PRECISION", "DOUBLE", "1.5"},
+	"decimal": {"float64", "NUMERIC(12,2)", "DECIMAL(12,2)", "9.99"},
+	"bool":    {"bool", "BOOLEAN", "BOOLEAN", "true"},
+	"time":    {"time.Time", "TIMESTAMPTZ", "DATETIME(3)", `"2024-01-01T00:00:00Z"`},
+	"uuid":    {"string", "UUID", "CHAR(36)", `"123e4567-e89b-12d3-a456-426614174000"`},
+}
+
+// FieldTypes returns the supported field types, sorted.
+func FieldTypes() []string {
+	names := make([]string, 0, len(fieldTypes))
+	for name := range fieldTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Field is a resource attribute parsed from name:type[:optional].
+type Field struct {
+	Name     string // Go field name, e.g. UnitPrice
+	Column   string // column, BSON and JSON name, e.g. unit_price
+	Type     string
+	Optional bool
+	fieldType
+}
+
+// BaseGoType is the Go type of the field without optionality.
+func (f Field) BaseGoType() string { return f.goType }
+
+// GoType is the type of the domain field; optional fields are pointers.
+func (f Field) GoType() string {
+	if f.Optional {
+		return "*" + f.goType
+	}
+	return f.goType
+}
+
+// IsString reports whether blank values should be rejected.
+func (f Field) IsString() bool { return f.goType == "string" }
+
+// Sample returns a valid value for the generated tests.
+func (f Field) Sample() string { return f.sample }
+
+// SQLType returns the column type for the given store.
+func (f Field) SQLType(store string) string {
+	if store == "mysql" {
+		return f.mysql
+	}
+	return f.postgres
+}
+
+// Resource is everything the templates need to render one resource.
+type Resource struct {
+	Module string
+	Name   string // exported Go name, e.g. OrderItem
+	Var    string // variable name, e.g. orderItem
+	Plural string // e.g. OrderItems
+	File   string // file base name, e.g. order_item
+	Table  string // table or collection, e.g. order_items
+	Route  string // route group, e.g. /order-items
+	Tag    string // swagger tag, e.g. order-items
+	Store  string
+	Driver string
+	Mongo  bool
+	Fields []Field
+	// Version prefixes the migration files
+	Version string
+}
+
+// reserved are identifiers the templates use next to the resource variable.
+var reserved = map[string]bool{
+	"app": true, "bytes": true, "c": true, "context": true, "ctx": true,
+	"cursor": true, "domain": true, "err": true, "errors": true, "errs": true,
+	"fiber": true, "group": true, "h": true, "http": true, "httptest": true,
+	"id": true, "items": true, "json": true, "key": true, "limit": true,
+	"now": true, "offset": true, "oid": true, "opts": true, "r": true,
+	"repo": true, "repository": true, "req": true, "res": true, "resp": true,
+	"slog": true, "strconv": true, "strings": true, "sync": true, "t": true,
+	"testing": true, "time": true, "bson": true, "mongo": true, "gorm": true,
+	"options": true, "primitive": true, "body": true, "buf": true,
+	"database": true, "page": true,
+}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// NewResource parses the resource name and field arguments.
+func NewResource(name string, fields []string, store string) (*Resource, error) {
+	kind, ok := storeKinds[store]
+	if !ok {
+		return nil, fmt.Errorf("unknown datastore %q (available: %s)", store, strings.Join(Stores(), ", "))
+	}
+	if !identPattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid resource name %q", name)
+	}
+
+	words := splitWords(name)
+	plural := append(append([]string(nil), words[:len(words)-1]...), pluralize(words[len(words)-1]))
+	res := &Resource{
+		Name:   exported(words),
+		Var:    unexported(words),
+		Plural: exported(plural),
+		File:   strings.Join(words, "_"),
+		Table:  strings.Join(plural, "_"),
+		Route:  "/" + strings.Join(plural, "-"),
+		Tag:    strings.Join(plural, "-"),
+		Store:  store,
+		Driver: kind.driver,
+		Mongo:  kind.mongo,
+	}
+	if token.IsKeyword(res.Var) || reserved[res.Var] {
+		return nil, fmt.Errorf("resource name %q is reserved", name)
+	}
+
+	seen := map[string]bool{"id": true, "created_at": true, "updated_at": true}
+	for _, arg := range fields {
+		parts := strings.Split(arg, ":")
+		if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "optional") {
+			return nil, fmt.Errorf("invalid field %q, expected name:type or name:type:optional", arg)
+		}
+		if !identPattern.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid field name %q", parts[0])
+		}
+		ft, ok := fieldTypes[strings.ToLower(parts[1])]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q for field %s (available: %s)", parts[1], parts[0], strings.Join(FieldTypes(), ", "))
+		}
+
+		fieldWords := splitWords(parts[0])
+		column := strings.Join(fieldWords, "_")
+		if seen[column] {
+			return nil, fmt.Errorf("duplicate or reserved field %q", parts[0])
+		}
+		seen[column] = true
+		res.Fields = append(res.Fields, Field{
+			Name:      exported(fieldWords),
+			Column:    column,
+			Type:      strings.ToLower(parts[1]),
+			Optional:  len(parts) == 3,
+			fieldType: ft,
+		})
+	}
+	return res, nil
+}
+
+// HasRequired reports whether any field is required.
+func (r *Resource) HasRequired() bool {
+	for _, f := range r.Fields {
+		if !f.Optional {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRequiredString reports whether the handler checks for blank strings.
+func (r *Resource) HasRequiredString() bool {
+	for _, f := range r.Fields {
+		if !f.Optional && f.IsString() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTime reports whether a field is a time.Time.
+func (r *Resource) HasTime() bool {
+	for _, f := range r.Fields {
+		if f.Type == "time" {
+			return true
+		}
+	}
+	return false
+}
+
+// Change records what Generate did with a path.
+type Change struct {
+	Action string // create, replace, update or skip
+	Path   string
+}
+
+// Generate writes the resource into the service rooted at dir and registers
+// its routes. Existing files are skipped unless force is set.
+func (r *Resource) Generate(dir string, force bool) ([]Change, error) {
+	module, err := readModule(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	r.Module = module
+
+	storeFile := filepath.Join(dir, "internal", "database", r.Store+".go")
+	if _, err := os.Stat(storeFile); err != nil {
+		return nil, fmt.Errorf("the service has no %s datastore (%s not found)", r.Store, filepath.ToSlash(storeFile))
+	}
+
+	repoTemplate := "repository_gorm.go.tmpl"
+	if r.Mongo {
+		repoTemplate = "repository_mongo.go.tmpl"
+	}
+	files := []struct{ path, tmpl string }{
+		{"internal/domain/" + r.File + ".go", "domain.go.tmpl"},
+		{"internal/repository/repository.go", "repository.go.tmpl"},
+		{"internal/repository/" + r.File + ".go", repoTemplate},
+		{"internal/api/v1/handlers/" + r.File + ".go", "handler.go.tmpl"},
+		{"internal/api/v1/handlers/" + r.File + "_test.go", "handler_test.go.tmpl"},
+	}
+	if !r.Mongo {
+		up, down, err := r.migrationPaths(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files,
+			struct{ path, tmpl string }{up, "migration.up.sql.tmpl"},
+			struct{ path, tmpl string }{down, "migration.down.sql.tmpl"},
+		)
+	}
+
+	var changes []Change
+	for _, f := range files {
+		target := filepath.Join(dir, filepath.FromSlash(f.path))
+		action := "create"
+		if _, err := os.Stat(target); err == nil {
+			// The shared repository file is identical for every resource
+			if !force || f.tmpl == "repository.go.tmpl" {
+				changes = append(changes, Change{"skip", f.path})
+				continue
+			}
+			action = "replace"
+		}
+
+		data, err := r.render(f.tmpl)
+		if err != nil {
+			return changes, fmt.Errorf("render %s: %w", f.path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return changes, err
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return changes, err
+		}
+		changes = append(changes, Change{action, f.path})
+	}
+
+	routes := "internal/api/v1/routes.go"
+	updated, err := registerRoutes(filepath.Join(dir, filepath.FromSlash(routes)), r)
+	if err != nil {
+		return changes, fmt.Errorf("update %s: %w", routes, err)
+	}
+	if updated {
+		changes = append(changes, Change{"update", routes})
+	} else {
+		changes = append(changes, Change{"skip", routes})
+	}
+	return changes, nil
+}
+
+// migrationPaths returns the migration files of the resource, reusing the
+// version of an earlier run so the migration is not created twice.
+func (r *Resource) migrationPaths(dir string) (up, down string, err error) {
+	rel := "migrations/" + r.Store
+	suffix := "_create_" + r.Table
+	matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(rel), "*"+suffix+".up.sql"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(matches) > 0 {
+		r.Version = strings.TrimSuffix(filepath.Base(matches[0]), suffix+".up.sql")
+	} else {
+		r.Version = time.Now().UTC().Format("20060102150405")
+	}
+	base := rel + "/" + r.Version + suffix
+	return base + ".up.sql", base + ".down.sql", nil
+}
+
+func (r *Resource) render(name string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, r); err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, ".go.tmpl") {
+		return format.Source(buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+func readModule(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s not found; run the command from the root of the service or pass --dir", path)
+	}
+	if err != nil {
+		return "", err
+	}
+	m := regexp.MustCompile(`(?m)^module\s+(\S+)`).FindSubmatch(data)
+	if m == nil {
+		return "", fmt.Errorf("no module directive in %s", path)
+	}
+	return string(m[1]), nil
+}
+
+// splitWords splits OrderItem, orderItem, order_item and order-item into
+// lower-case words.
+func splitWords(s string) []string {
+	var words []string
+	var cur []rune
+	runes := []rune(s)
+	for i, c := range runes {
+		switch {
+		case c == '_' || c == '-':
+			if len(cur) > 0 {
+				words = append(words, string(cur))
+				cur = nil
+			}
+			continue
+		case unicode.IsUpper(c) && len(cur) > 0:
+			// Start a word at aB and at the last capital of ABc
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(cur))
+				cur = nil
+			}
+		}
+		cur = append(cur, unicode.ToLower(c))
+	}
+	if len(cur) > 0 {
+		words = append(words, string(cur))
+	}
+	return words
+}
+
+// initialisms are written in upper case in Go names.
+var initialisms = map[string]bool{
+	"api": true, "id": true, "ip": true, "json": true, "sku": true,
+	"sql": true, "url": true, "uri": true, "uuid": true,
+}
+
+func exported(words []string) string {
+	var b strings.Builder
+	for _, w := range words {
+		if initialisms[w] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+func unexported(words []string) string {
+	return words[0] + exported(words[1:])
+}
+
+func pluralize(w string) string {
+	switch {
+	case strings.HasSuffix(w, "y") && len(w) > 1 && !strings.ContainsRune("aeiou", rune(w[len(w)-2])):
+		return w[:len(w)-1] + "ies"
+	case strings.HasSuffix(w, "s"), strings.HasSuffix(w, "x"), strings.HasSuffix(w, "z"),
+		strings.HasSuffix(w, "ch"), strings.HasSuffix(w, "sh"):
+		return w + "es"
+	default:
+		return w + "s"
+	}
+}
@@ -0,0 +1,178 @@
+package generate
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// registerRoutes adds the route registration of res to RegisterRoutes in the
+// routes file at path. It reports false if the routes were registered
+// already. The file is edited as text at positions found in its syntax tree
+// so the hand-written code and comments are kept as they are.
+func registerRoutes(path string, res *Resource) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, data, parser.ParseComments)
+	if err != nil {
+		return false, err
+	}
+
+	fn := findFunc(file, "RegisterRoutes")
+	if fn == nil || fn.Body == nil {
+		return false, fmt.Errorf("RegisterRoutes not found")
+	}
+	register := "Register" + res.Name + "Routes"
+	if callsSelector(fn.Body, "handlers", register) {
+		return false, nil
+	}
+
+	datastores := paramOfType(fn, "database", "Registry")
+	if datastores == "" {
+		return false, fmt.Errorf("RegisterRoutes has no *database.Registry parameter")
+	}
+	router := groupVar(fn.Body, "/v1")
+	if router == "" {
+		router = fn.Type.Params.List[0].Names[0].Name
+	}
+
+	var block strings.Builder
+	fmt.Fprintf(&block, "\t// %s\n", res.Plural)
+	if res.Mongo {
+		fmt.Fprintf(&block, "\tif mongoStore, ok := %s.Mongo(); ok {\n", datastores)
+		fmt.Fprintf(&block, "\t\thandlers.%s(%s, repository.New%sRepository(mongoStore.Database))\n", register, router, res.Name)
+	} else {
+		fmt.Fprintf(&block, "\tif db, ok := %s.SQL(database.%s); ok {\n", datastores, res.Driver)
+		fmt.Fprintf(&block, "\t\thandlers.%s(%s, repository.New%sRepository(db))\n", register, router, res.Name)
+	}
+	block.WriteString("\t}\n\n")
+
+	// Insert above the "Add other routes here" placeholder, or at the end
+	insertAt := lineStart(data, fset.Position(fn.Body.Rbrace).Offset)
+	for _, group := range file.Comments {
+		if group.Pos() > fn.Body.Lbrace && group.End() < fn.Body.Rbrace &&
+			strings.HasPrefix(group.Text(), "Add other routes here") {
+			insertAt = lineStart(data, fset.Position(group.Pos()).Offset)
+			break
+		}
+	}
+	edits := []edit{{at: insertAt, text: block.String()}}
+
+	if imp := missingImport(file, res.Module+"/internal/repository"); imp != "" {
+		last := file.Imports[len(file.Imports)-1]
+		for _, spec := range file.Imports {
+			if p, _ := strconv.Unquote(spec.Path.Value); strings.HasPrefix(p, res.Module+"/") {
+				last = spec
+			}
+		}
+		at := fset.Position(last.End()).Offset
+		edits = append([]edit{{at: at, text: "\n\t" + imp}}, edits...)
+	}
+
+	out := append([]byte(nil), data...)
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		out = append(out[:e.at], append([]byte(e.text), out[e.at:]...)...)
+	}
+	out, err = format.Source(out)
+	if err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, out, 0o644)
+}
+
+type edit struct {
+	at   int
+	text string
+}
+
+func lineStart(data []byte, offset int) int {
+	for offset > 0 && data[offset-1] != '\n' {
+		offset--
+	}
+	return offset
+}
+
+func findFunc(file *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// callsSelector reports whether body calls pkg.name.
+func callsSelector(body *ast.BlockStmt, pkg, name string) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok && sel.Sel.Name == name {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == pkg {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// paramOfType returns the name of the *pkg.typ parameter of fn.
+func paramOfType(fn *ast.FuncDecl, pkg, typ string) string {
+	for _, field := range fn.Type.Params.List {
+		star, ok := field.Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		sel, ok := star.X.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != typ {
+			continue
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && id.Name == pkg && len(field.Names) > 0 {
+			return field.Names[0].Name
+		}
+	}
+	return ""
+}
+
+// groupVar returns the variable assigned from a Group(prefix) call in body.
+func groupVar(body *ast.BlockStmt, prefix string) string {
+	for _, stmt := range body.List {
+		assign, ok := stmt.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			continue
+		}
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			continue
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Group" {
+			continue
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Value == strconv.Quote(prefix) {
+			if id, ok := assign.Lhs[0].(*ast.Ident); ok {
+				return id.Name
+			}
+		}
+	}
+	return ""
+}
+
+// missingImport returns the import spec to add for path, if any.
+func missingImport(file *ast.File, path string) string {
+	quoted := strconv.Quote(path)
+	for _, spec := range file.Imports {
+		if spec.Path.Value == quoted {
+			return ""
+		}
+	}
+	return quoted
+}
@@ -1,10 +1,22 @@
-package gorbit
+package main
 
 import (
+	"gorbit/cmd/gorbit/configcmd"
+	"gorbit/cmd/gorbit/db"
+	"gorbit/cmd/gorbit/generate"
+	"gorbit/cmd/gorbit/migrate"
+	"gorbit/cmd/gorbit/newcmd"
+	"gorbit/cmd/gorbit/serve"
 	"gorbit/cmd/gorbit/version"
 )
 
 func main() {
 	rootCmd.AddCommand(version.Cmd)
+	rootCmd.AddCommand(configcmd.Cmd)
+	rootCmd.AddCommand(serve.Cmd)
+	rootCmd.AddCommand(newcmd.Cmd)
+	rootCmd.AddCommand(generate.Cmd)
+	rootCmd.AddCommand(migrate.Cmd)
+	rootCmd.AddCommand(db.Cmd)
 	Execute()
 }
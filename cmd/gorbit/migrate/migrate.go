@@ -0,0 +1,337 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"gorbit/internal/config"
+	"gorbit/internal/database"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configDir     string
+	env           string
+	migrationsDir string
+	storeNames    []string
+	dryRun        bool
+)
+
+var Cmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply and manage schema migrations",
+	Long: `Manage the versioned migrations in migrations/<store>: SQL files
+(<version>_<name>.up.sql and .down.sql) for mysql and postgres, JSON files
+(<version>_<name>.json) and registered Go migrations for mongodb. Applied
+versions are recorded with a checksum in the schema_migrations table or
+the _gorbit_migrations collection, and a lock keeps concurrent runs from
+applying a migration twice.
+
+Commands act on every enabled datastore unless --store is given.`,
+}
+
+var upCmd = &cobra.Command{
+	Use:   "up [N]",
+	Short: "Apply all or the next N pending migrations",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := countArg(args)
+		if err != nil {
+			return err
+		}
+		return eachMigrator(cmd, false, func(ctx context.Context, name string, m database.SchemaMigrator) error {
+			if dryRun {
+				return printPlan(ctx, cmd, name, m, n, false)
+			}
+			applied, err := m.Up(ctx, n)
+			for _, mig := range applied {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: applied %d_%s\n", name, mig.Version, mig.Name)
+			}
+			if err == nil && len(applied) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: no pending migrations\n", name)
+			}
+			return err
+		})
+	},
+}
+
+var downCmd = &cobra.Command{
+	Use:   "down [N]",
+	Short: "Revert the last or the last N applied migrations",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := countArg(args)
+		if err != nil {
+			return err
+		}
+		return eachMigrator(cmd, true, func(ctx context.Context, name string, m database.SchemaMigrator) error {
+			if dryRun {
+				return printPlan(ctx, cmd, name, m, n, true)
+			}
+			reverted, err := m.Down(ctx, n)
+			for _, mig := range reverted {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: reverted %d_%s\n", name, mig.Version, mig.Name)
+			}
+			if err == nil && len(reverted) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: no applied migrations\n", name)
+			}
+			return err
+		})
+	},
+}
+
+var redoCmd = &cobra.Command{
+	Use:   "redo",
+	Short: "Revert and re-apply the last applied migration",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return eachMigrator(cmd, true, func(ctx context.Context, name string, m database.SchemaMigrator) error {
+			mig, err := m.Redo(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: redone %d_%s\n", name, mig.Version, mig.Name)
+			return nil
+		})
+	},
+}
+
+var forceCmd = &cobra.Command{
+	Use:   "force <version>",
+	Short: "Mark a version as the last applied migration without running it",
+	Long: `Record <version> as applied and clean and forget every later version,
+without running it. Use it after fixing the schema by hand when a
+migration failed part way and left the database dirty. Version 0 forgets
+every applied migration.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		return eachMigrator(cmd, true, func(ctx context.Context, name string, m database.SchemaMigrator) error {
+			if err := m.Force(ctx, version); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: forced version %d\n", name, version)
+			return nil
+		})
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List applied and pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STORE\tVERSION\tNAME\tSTATUS\tAPPLIED AT")
+		err := eachMigrator(cmd, false, func(ctx context.Context, name string, m database.SchemaMigrator) error {
+			list, err := m.Status(ctx)
+			if err != nil {
+				return err
+			}
+			for _, s := range list {
+				appliedAt := "-"
+				if s.Applied {
+					appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", name, s.Version, s.Name, statusText(s), appliedAt)
+			}
+			return nil
+		})
+		if flushErr := w.Flush(); err == nil {
+			err = flushErr
+		}
+		return err
+	},
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an empty migration",
+	Long: `Create an empty up/down SQL pair for mysql and postgres, or a JSON
+migration for mongodb.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		names, err := selectStores(cfg, true)
+		if err != nil {
+			return err
+		}
+
+		paths, err := driverFor(names[0]).CreateMigration(filepath.Join(dirFor(cfg), names[0]), args[0])
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %s\n", path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	Cmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "configuration directory (default $"+config.ConfigDirEnv+" or ./"+config.DefaultConfigDir+")")
+	Cmd.PersistentFlags().StringVar(&env, "env", "", "configuration profile (default $"+config.EnvVar+" or app.env)")
+	Cmd.PersistentFlags().StringVar(&migrationsDir, "dir", "", "migrations directory (default databases.migrations_dir or ./"+database.DefaultMigrationsDir+")")
+	Cmd.PersistentFlags().StringSliceVar(&storeNames, "store", nil, "datastores to act on: mysql, postgres, mongodb (default: all enabled)")
+	for _, c := range []*cobra.Command{upCmd, downCmd} {
+		c.Flags().BoolVar(&dryRun, "dry-run", false, "report what would change without applying it")
+	}
+
+	Cmd.AddCommand(upCmd, downCmd, redoCmd, forceCmd, statusCmd, createCmd)
+	for _, c := range Cmd.Commands() {
+		c.SilenceUsage = true
+	}
+}
+
+func loadConfig() (*config.Config, error) {
+	return config.LoadConfig(config.WithConfigDir(configDir), config.WithEnv(env))
+}
+
+func dirFor(cfg *config.Config) string {
+	switch {
+	case migrationsDir != "":
+		return migrationsDir
+	case cfg.Databases.MigrationsDir != "":
+		return cfg.Databases.MigrationsDir
+	default:
+		return database.DefaultMigrationsDir
+	}
+}
+
+// selectStores returns the datastores with migrations named with --store,
+// or the enabled ones. With single set, exactly one store must be selected.
+func selectStores(cfg *config.Config, single bool) ([]string, error) {
+	var names []string
+	if len(storeNames) > 0 {
+		for _, name := range storeNames {
+			d := driverFor(name)
+			if d.CreateMigration == nil {
+				return nil, fmt.Errorf("%q is not a datastore with migrations in this service", name)
+			}
+			if !d.Enabled(cfg) {
+				return nil, fmt.Errorf("%s is disabled in the configuration", name)
+			}
+			names = append(names, name)
+		}
+	} else {
+		for _, d := range database.Drivers() {
+			if d.CreateMigration != nil && d.Enabled(cfg) {
+				names = append(names, d.Name)
+			}
+		}
+	}
+
+	switch {
+	case len(names) == 0:
+		return nil, errors.New("no datastore with migrations is enabled")
+	case single && len(names) > 1:
+		return nil, fmt.Errorf("several datastores are enabled (%v); choose one with --store", names)
+	}
+	return names, nil
+}
+
+// driverFor returns the registered driver called name, or the zero Driver.
+func driverFor(name string) database.Driver {
+	for _, d := range database.Drivers() {
+		if d.Name == name {
+			return d
+		}
+	}
+	return database.Driver{}
+}
+
+// eachMigrator connects to the selected stores in turn and runs fn with a
+// SchemaMigrator for their migrations. Interrupting the command cancels fn.
+func eachMigrator(cmd *cobra.Command, single bool, fn func(ctx context.Context, name string, m database.SchemaMigrator) error) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	names, err := selectStores(cfg, single)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, name := range names {
+		if err := withMigrator(ctx, cfg, name, fn); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func withMigrator(ctx context.Context, cfg *config.Config, name string, fn func(ctx context.Context, name string, m database.SchemaMigrator) error) error {
+	store, err := driverFor(name).Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close(context.Background())
+
+	migratable, ok := store.(database.Migratable)
+	if !ok {
+		return fmt.Errorf("%s has no migrations", name)
+	}
+	m, err := migratable.Migrator(filepath.Join(dirFor(cfg), name))
+	if err != nil {
+		return err
+	}
+	return fn(ctx, name, m)
+}
+
+// printPlan prints the changes Up, or Down if down is set, would make.
+func printPlan(ctx context.Context, cmd *cobra.Command, name string, m database.SchemaMigrator, n int, down bool) error {
+	steps, err := m.Plan(ctx, n, down)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: nothing to do\n", name)
+	}
+	for _, step := range steps {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %d_%s: %s\n", name, step.Version, step.Name, step.Change)
+	}
+	return nil
+}
+
+func statusText(s database.MigrationStatus) string {
+	switch {
+	case s.Dirty:
+		return "dirty"
+	case s.Missing:
+		return "applied (file missing)"
+	case s.Modified:
+		return "applied (modified)"
+	case s.Applied:
+		return "applied"
+	default:
+		return "pending"
+	}
+}
+
+func countArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
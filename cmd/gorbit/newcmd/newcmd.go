@@ -0,0 +1,62 @@
+package newcmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gorbit"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dir    string
+	stores []string
+	force  bool
+)
+
+var Cmd = &cobra.Command{
+	Use:   "new <module-path>",
+	Short: "Create a new Gorbit service",
+	Long: `Generate a ready-to-run service with the Gorbit layout (cmd/api,
+internal/..., configs/, Dockerfile and docker-compose.yml) using the given
+Go module path. Datastores left out with --stores are removed from the code,
+the configuration and docker-compose.yml.`,
+	Example:      `  gorbit new github.com/acme/orders --stores postgres,redis`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		module := args[0]
+		target := dir
+		if target == "" {
+			target = path.Base(module)
+		}
+
+		written, err := Generate(gorbit.Template, Options{
+			Module: module,
+			Dir:    target,
+			Stores: stores,
+			Force:  force,
+		})
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Created %s in %s (%d files)\n", module, target, len(written))
+		storeList := strings.Join(stores, ", ")
+		if storeList == "" {
+			storeList = "none"
+		}
+		fmt.Fprintf(out, "Datastores: %s\n\n", storeList)
+		fmt.Fprintf(out, "Next steps:\n  cd %s\n  go build ./...\n  docker-compose up -d --build\n", target)
+		return nil
+	},
+}
+
+func init() {
+	Cmd.Flags().StringVarP(&dir, "dir", "d", "", "output directory (default: last element of the module path)")
+	Cmd.Flags().StringSliceVar(&stores, "stores", StoreNames(), "datastores to include: "+strings.Join(StoreNames(), ", "))
+	Cmd.Flags().BoolVar(&force, "force", false, "write into a non-empty directory")
+}
@@ -0,0 +1,470 @@
+package newcmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateModule is the module path of the embedded sources.
+const templateModule = "gorbit"
+
+// datastore lists what belongs to an optional store in the template.
+type datastore struct {
+	// paths are template files or directories only needed by the store
+	paths []string
+	// configKey is the section removed from database.yaml, if any
+	configKey string
+	// service is the docker-compose service (and <service>-data volume)
+	service string
+}
+
+// Datastores are the stores a new project can include.
+var Datastores = map[string]datastore{
+	"mysql": {
+		paths:     []string{"internal/database/mysql.go", "internal/database/mysql_test.go", "migrations/mysql", "seeds/demo/mysql", "seeds/e2e/mysql"},
+		configKey: "mysql",
+		service:   "mysql",
+	},
+	"postgres": {
+		paths:     []string{"internal/database/postgres.go", "migrations/postgres", "seeds/demo/postgres", "seeds/e2e/postgres"},
+		configKey: "postgres",
+		service:   "postgres",
+	},
+	"mongodb": {
+		paths:     []string{"internal/database/mongodb.go", "internal/database/mongo_migrate.go", "internal/database/mongo_seed.go", "internal/database/mongo_repository.go", "migrations/mongodb", "seeds/demo/mongodb", "seeds/e2e/mongodb"},
+		configKey: "mongodb",
+		service:   "mongodb",
+	},
+	"redis": {
+		paths: []string{
+			"internal/cache", "configs/redis.yaml",
+			"migrations/mysql/20261018000000_create_outbox_events.up.sql",
+			"migrations/mysql/20261018000000_create_outbox_events.down.sql",
+			"migrations/postgres/20261018000000_create_outbox_events.up.sql",
+			"migrations/postgres/20261018000000_create_outbox_events.down.sql",
+		},
+		service: "redis",
+	},
+}
+
+// excludedPaths are template paths never copied into a new project; the
+// scaffolding command depends on the embedded template itself.
+var excludedPaths = []string{"cmd/gorbit/newcmd"}
+
+// Options describes the project to generate.
+type Options struct {
+	Module string
+	Dir    string
+	Stores []string
+	Force  bool
+}
+
+var modulePathPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._~/-]*[A-Za-z0-9]$`)
+
+// Generate renders the template into opts.Dir with the module path
+// rewritten and the datastores not in opts.Stores left out.
+func Generate(template fs.FS, opts Options) ([]string, error) {
+	if !modulePathPattern.MatchString(opts.Module) || strings.Contains(opts.Module, "//") {
+		return nil, fmt.Errorf("invalid module path %q", opts.Module)
+	}
+	if err := checkTarget(opts.Dir, opts.Force); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool)
+	for _, name := range opts.Stores {
+		if _, ok := Datastores[name]; !ok {
+			return nil, fmt.Errorf("unknown datastore %q (available: %s)", name, strings.Join(StoreNames(), ", "))
+		}
+		keep[name] = true
+	}
+
+	r := &renderer{
+		module:  opts.Module,
+		project: path.Base(opts.Module),
+		omitted: make(map[string]datastore),
+		skip:    append([]string(nil), excludedPaths...),
+	}
+	for name, store := range Datastores {
+		if !keep[name] {
+			r.omitted[name] = store
+			r.skip = append(r.skip, store.paths...)
+		}
+	}
+
+	var written []string
+	err := fs.WalkDir(template, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if r.skipped(p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(template, p)
+		if err != nil {
+			return err
+		}
+		data, err = r.render(p, data)
+		if err != nil {
+			return fmt.Errorf("render %s: %w", p, err)
+		}
+		if data == nil {
+			return nil
+		}
+
+		if err := writeFile(filepath.Join(opts.Dir, filepath.FromSlash(p)), data); err != nil {
+			return err
+		}
+		written = append(written, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, content := range map[string]string{
+		"README.md":  readme(r.project, opts.Module, opts.Stores),
+		".gitignore": "/bin/\n*.log\n",
+	} {
+		if err := writeFile(filepath.Join(opts.Dir, name), []byte(content)); err != nil {
+			return nil, err
+		}
+		written = append(written, name)
+	}
+
+	sort.Strings(written)
+	return written, nil
+}
+
+// StoreNames returns the available datastores, sorted.
+func StoreNames() []string {
+	names := make([]string, 0, len(Datastores))
+	for name := range Datastores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type renderer struct {
+	module  string
+	project string
+	omitted map[string]datastore
+	skip    []string
+}
+
+func (r *renderer) skipped(p string) bool {
+	for _, s := range r.skip {
+		if p == s || strings.HasPrefix(p, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// render transforms a template file; a nil result drops the file.
+func (r *renderer) render(p string, data []byte) ([]byte, error) {
+	switch {
+	case strings.HasSuffix(p, ".go"):
+		return r.renderGo(p, data)
+	case p == "go.mod":
+		return regexp.MustCompile(`(?m)^module\s+\S+`).ReplaceAll(data, []byte("module "+r.module)), nil
+	case p == "docker-compose.yml":
+		return r.renderCompose(data)
+	case p == "configs/config.yaml":
+		return regexp.MustCompile(`(?m)^(\s+name:\s*)"Gorbit"`).ReplaceAll(data, []byte(`${1}"`+r.project+`"`)), nil
+	case strings.HasPrefix(p, "configs/database") && strings.HasSuffix(p, ".yaml"):
+		return r.renderDatabaseConfig(data)
+	default:
+		return data, nil
+	}
+}
+
+// renderGo rewrites import paths to the new module and removes the imports
+// and statements referring to packages that were left out. Edits are made
+// on the source text so comments stay where they were.
+func (r *renderer) renderGo(p string, data []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, p, data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []edit
+	for _, imp := range file.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		if !strings.HasPrefix(importPath, templateModule+"/") {
+			continue
+		}
+
+		rel := strings.TrimPrefix(importPath, templateModule+"/")
+		if !r.skipped(rel) {
+			edits = append(edits, edit{
+				start: fset.Position(imp.Path.Pos()).Offset,
+				end:   fset.Position(imp.Path.End()).Offset,
+				text:  strconv.Quote(r.module + "/" + rel),
+			})
+			continue
+		}
+
+		edits = append(edits, lineEdit(fset, data, imp))
+		name := path.Base(rel)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name != "_" {
+			for _, stmt := range statementsUsing(file, name) {
+				edits = append(edits, lineEdit(fset, data, stmt))
+			}
+		}
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := append([]byte(nil), data...)
+	for _, e := range edits {
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+
+	// Re-format so import groups are sorted for the new module path
+	return format.Source(out)
+}
+
+type edit struct {
+	start, end int
+	text       string
+}
+
+// lineEdit deletes the full lines spanned by n, including a trailing comment.
+func lineEdit(fset *token.FileSet, data []byte, n ast.Node) edit {
+	start := fset.Position(n.Pos()).Offset
+	end := fset.Position(n.End()).Offset
+	for start > 0 && data[start-1] != '\n' {
+		start--
+	}
+	for end < len(data) && data[end] != '\n' {
+		end++
+	}
+	if end < len(data) {
+		end++
+	}
+	return edit{start: start, end: end}
+}
+
+// statementsUsing returns the statements referring to package pkg.
+func statementsUsing(file *ast.File, pkg string) []ast.Stmt {
+	uses := func(n ast.Node) bool {
+		found := false
+		ast.Inspect(n, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && id.Name == pkg {
+					found = true
+				}
+			}
+			return !found
+		})
+		return found
+	}
+
+	// An if left empty goes too, e.g. one guarding a feature of the store
+	var removable func(stmt ast.Stmt) bool
+	removable = func(stmt ast.Stmt) bool {
+		if uses(stmt) {
+			return true
+		}
+		ifStmt, ok := stmt.(*ast.IfStmt)
+		if !ok || ifStmt.Else != nil || len(ifStmt.Body.List) == 0 {
+			return false
+		}
+		for _, s := range ifStmt.Body.List {
+			if !removable(s) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Statements nested in a removed one go with it
+	var stmts []ast.Stmt
+	removed := make(map[ast.Node]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if removed[n] {
+			return false
+		}
+		block, ok := n.(*ast.BlockStmt)
+		if !ok {
+			return true
+		}
+		for _, stmt := range block.List {
+			if removable(stmt) {
+				stmts = append(stmts, stmt)
+				removed[stmt] = true
+			}
+		}
+		return true
+	})
+	return stmts
+}
+
+func (r *renderer) renderDatabaseConfig(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	databases := mappingValue(doc.Content[0], "databases")
+	for _, store := range r.omitted {
+		if store.configKey != "" && databases != nil {
+			deleteKey(databases, store.configKey)
+		}
+	}
+
+	// Drop the file once no database section is left
+	for _, store := range Datastores {
+		if store.configKey != "" && mappingValue(databases, store.configKey) != nil {
+			return encodeYAML(&doc)
+		}
+	}
+	return nil, nil
+}
+
+func (r *renderer) renderCompose(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+
+	services := mappingValue(root, "services")
+	volumes := mappingValue(root, "volumes")
+	for _, store := range r.omitted {
+		deleteKey(services, store.service)
+		if volumes != nil {
+			deleteKey(volumes, store.service+"-data")
+		}
+	}
+
+	// Drop dependencies on removed services and name the container after the project
+	for i := 1; i < len(services.Content); i += 2 {
+		service := services.Content[i]
+		if name := mappingValue(service, "container_name"); name != nil && name.Value == templateModule {
+			name.Value = r.project
+		}
+		deps := mappingValue(service, "depends_on")
+		if deps == nil {
+			continue
+		}
+		for _, store := range r.omitted {
+			deleteKey(deps, store.service)
+		}
+		if len(deps.Content) == 0 {
+			deleteKey(service, "depends_on")
+		}
+	}
+	if volumes != nil && len(volumes.Content) == 0 {
+		deleteKey(root, "volumes")
+	}
+
+	return encodeYAML(&doc)
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func deleteKey(mapping *yaml.Node, key string) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func encodeYAML(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func checkTarget(dir string, force bool) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 && !force {
+		return fmt.Errorf("directory %s is not empty (use --force to write into it)", dir)
+	}
+	return nil
+}
+
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+func readme(project, module string, stores []string) string {
+	storeList := "none"
+	if len(stores) > 0 {
+		storeList = strings.Join(stores, ", ")
+	}
+	return fmt.Sprintf(`# %s
+
+Generated with `+"`gorbit new %s`"+`.
+
+Datastores: %s
+
+## Getting Started
+`+"```bash"+`
+go build ./...
+docker-compose up -d --build
+`+"```"+`
+
+Configuration lives in `+"`configs/`"+`; run `+"`go run ./cmd/gorbit config validate`"+` to check it and
+`+"`go run ./cmd/gorbit serve`"+` to start the API without Docker.
+`, project, module, storeList)
+}
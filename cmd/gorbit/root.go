@@ -1,4 +1,4 @@
-package gorbit
+package main
 
 import (
 	"fmt"
@@ -16,6 +16,8 @@ https://gorbit.io/docs`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Welcome to Gorbit CLI!")
 	},
+	// Execute prints the error itself
+	SilenceErrors: true,
 }
 
 func Execute() {
@@ -0,0 +1,63 @@
+package serve
+
+import (
+	"strconv"
+
+	"gorbit/internal/config"
+	"gorbit/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	host      string
+	port      int
+	configDir string
+	env       string
+	debug     bool
+	migrate   bool
+	overrides = config.Overrides{}
+)
+
+var Cmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the Gorbit API server",
+	Long: `Boot the API server exactly like cmd/api. Flags override the
+configuration files and GORBIT_* environment variables.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		values := make(map[string]string, len(overrides)+4)
+		for k, v := range overrides {
+			values[k] = v
+		}
+		if cmd.Flags().Changed("host") {
+			values["server.host"] = host
+		}
+		if cmd.Flags().Changed("port") {
+			values["server.port"] = strconv.Itoa(port)
+		}
+		if cmd.Flags().Changed("debug") {
+			values["server.debug"] = strconv.FormatBool(debug)
+		}
+		if cmd.Flags().Changed("migrate-on-start") {
+			values["databases.migrate_on_start"] = strconv.FormatBool(migrate)
+		}
+
+		return server.Run(
+			config.WithConfigDir(configDir),
+			config.WithEnv(env),
+			config.WithOverrides(values),
+		)
+	},
+}
+
+func init() {
+	Cmd.Flags().StringVar(&host, "host", "", "address to bind (overrides server.host)")
+	Cmd.Flags().IntVarP(&port, "port", "p", 0, "port to listen on (overrides server.port)")
+	Cmd.Flags().StringVar(&configDir, "config-dir", "", "configuration directory (default $"+config.ConfigDirEnv+" or ./"+config.DefaultConfigDir+")")
+	Cmd.Flags().StringVar(&env, "env", "", "configuration profile (default $"+config.EnvVar+" or app.env)")
+	Cmd.Flags().BoolVar(&debug, "debug", false, "enable debug mode (overrides server.debug)")
+	Cmd.Flags().BoolVar(&migrate, "migrate-on-start", false, "apply pending database migrations before serving (overrides databases.migrate_on_start)")
+	Cmd.Flags().Var(overrides, "set", "override a config key, e.g. --set server.port=9090 (repeatable)")
+}
@@ -5,11 +5,18 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
-	// "gorbit/internal/config"
 	"gorbit/internal/api/v1/handlers"
+	"gorbit/internal/config"
+	"gorbit/internal/database"
+	"gorbit/internal/outbox"
 )
 
-func SetupRouter(app *fiber.App, healthHandler *handlers.HealthHandler) {
+func SetupRouter(app *fiber.App, store *config.Store, datastores *database.Registry, healthHandler *handlers.HealthHandler, relay *outbox.Relay) {
+	// Kubernetes probes
+	app.Get("/livez", healthHandler.Liveness)
+	app.Get("/readyz", healthHandler.Readiness)
+	app.Get("/startupz", healthHandler.Startup)
+
 	apiGroup := app.Group("/api")
-	v1.RegisterRoutes(apiGroup, healthHandler)
+	v1.RegisterRoutes(apiGroup, store, datastores, healthHandler, relay)
 }
@@ -0,0 +1,74 @@
+// internal/api/v1/handlers/admin.go
+package handlers
+
+import (
+	"log/slog"
+
+	"gorbit/internal/config"
+	"gorbit/internal/outbox"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminHandler struct {
+	store *config.Store
+	// relay is nil unless the outbox relay runs
+	relay *outbox.Relay
+}
+
+func NewAdminHandler(store *config.Store, relay *outbox.Relay) *AdminHandler {
+	return &AdminHandler{store: store, relay: relay}
+}
+
+// @Summary Configuration reload history
+// @Description List the most recent configuration reloads, newest first
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} config.ReloadResult
+// @Router /api/v1/admin/config/reloads [get]
+func (h *AdminHandler) ConfigReloads(c *fiber.Ctx) error {
+	return c.JSON(h.store.History())
+}
+
+// @Summary Reload configuration
+// @Description Reload the configuration files and apply live settings
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} config.ReloadResult
+// @Failure 422 {object} config.ReloadResult
+// @Router /api/v1/admin/config/reload [post]
+func (h *AdminHandler) ReloadConfig(c *fiber.Ctx) error {
+	result := h.store.Reload()
+	if !result.Success {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+// @Summary Outbox relay metrics
+// @Description Events published, failed and dead-lettered since startup, and the events pending in the outbox
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} outbox.Stats
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/outbox [get]
+func (h *AdminHandler) OutboxStats(c *fiber.Ctx) error {
+	if h.relay == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Not Found",
+			"message": "Outbox relay not running",
+		})
+	}
+	stats, err := h.relay.Stats(c.UserContext())
+	if err != nil {
+		slog.Error("Failed to read outbox stats", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Internal Server Error",
+			"message": "Unexpected error",
+		})
+	}
+	return c.JSON(stats)
+}
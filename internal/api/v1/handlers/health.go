@@ -11,51 +11,124 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"gorbit/internal/cache"
 	"gorbit/internal/config"
 
-	// "gorbit/internal/database"
-
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/mongo"
-	"gorm.io/gorm"
 )
 
 type HealthHandler struct {
-	cfg         *config.Config
-	mysqlDB     *gorm.DB
-	postgresDB  *gorm.DB
-	mongoClient *mongo.Client
-	redisClient *cache.RedisClient
-	startTime   time.Time
-}
-
-func NewHealthHandler(
-	cfg *config.Config,
-	mysqlDB *gorm.DB,
-	postgresDB *gorm.DB,
-	mongoClient *mongo.Client,
-	redisClient *cache.RedisClient,
-) *HealthHandler {
+	cfg       *config.Config
+	startTime time.Time
+	started   atomic.Bool
+	draining  atomic.Bool
+	cacheTTL  time.Duration
+
+	mu       sync.RWMutex
+	checkers []HealthChecker
+
+	// stateMu serializes check runs so concurrent probes share one result.
+	stateMu     sync.Mutex
+	results     map[string]ServiceStatus
+	lastRefresh time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewHealthHandler(cfg *config.Config, checkers ...HealthChecker) *HealthHandler {
+	cacheTTL := cfg.Health.CacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultCacheTTL
+	}
+
 	return &HealthHandler{
-		cfg:         cfg,
-		mysqlDB:     mysqlDB,
-		postgresDB:  postgresDB,
-		mongoClient: mongoClient,
-		redisClient: redisClient,
-		startTime:   time.Now().UTC(),
+		cfg:       cfg,
+		startTime: time.Now().UTC(),
+		cacheTTL:  cacheTTL,
+		checkers:  checkers,
+		results:   make(map[string]ServiceStatus),
+	}
+}
+
+// Register adds health checkers reported by the health and readiness
+// endpoints. It may be called by application code at any time.
+func (h *HealthHandler) Register(checkers ...HealthChecker) {
+	h.mu.Lock()
+	h.checkers = append(h.checkers, checkers...)
+	h.mu.Unlock()
+
+	// Force the next request to run the new checkers
+	h.stateMu.Lock()
+	h.lastRefresh = time.Time{}
+	h.stateMu.Unlock()
+}
+
+// MarkStarted reports startup as complete to the startup probe.
+func (h *HealthHandler) MarkStarted() {
+	h.started.Store(true)
+}
+
+// SetDraining marks the service as shutting down so readiness fails and
+// load balancers stop routing new traffic to it.
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// StartRefresher re-runs the checks in the background every
+// health.refresh_interval (the cache TTL when unset), so probes are served
+// from the cache instead of hitting the dependencies.
+func (h *HealthHandler) StartRefresher() {
+	interval := h.cfg.Health.RefreshInterval
+	if interval <= 0 {
+		interval = h.cacheTTL
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	h.stop, h.done = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		h.refresh(context.Background())
+		for {
+			select {
+			case <-ticker.C:
+				h.refresh(context.Background())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopRefresher stops the background refresher started by StartRefresher.
+func (h *HealthHandler) StopRefresher(ctx context.Context) error {
+	if h.stop == nil {
+		return nil
+	}
+	close(h.stop)
+	h.stop = nil
+
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Version   string            `json:"version"`
-	Timestamp time.Time         `json:"timestamp"`
-	Uptime    string            `json:"uptime"`
-	System    SystemStats       `json:"system"`
-	Services  map[string]string `json:"services"`
+	Status    string                   `json:"status"`
+	Version   string                   `json:"version"`
+	Timestamp time.Time                `json:"timestamp"`
+	Uptime    string                   `json:"uptime"`
+	System    SystemStats              `json:"system"`
+	Services  map[string]ServiceStatus `json:"services"`
 }
 
 type SystemStats struct {
@@ -65,77 +138,169 @@ type SystemStats struct {
 	NumGoroutine int    `json:"num_goroutine"`
 }
 
-func (h *HealthHandler) HealthCheck(c *fiber.Ctx) error {
-	services := make(map[string]string)
-	ctx := context.Background()
-
-	// Check MySQL
-	services["mysql"] = h.checkMySQL(ctx)
-
-	// Check PostgreSQL
-	services["postgres"] = h.checkPostgreSQL(ctx)
-
-	// Check MongoDB
-	services["mongodb"] = h.checkMongoDB(ctx)
+// ServiceStatus is the latest result of a single health check.
+type ServiceStatus struct {
+	Status              string     `json:"status"`
+	Critical            bool       `json:"critical"`
+	LatencyMs           float64    `json:"latency_ms"`
+	CheckedAt           time.Time  `json:"checked_at"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Error               string     `json:"error,omitempty"`
+}
 
-	// Check Redis
-	services["redis"] = h.checkRedis(ctx)
+type ProbeResponse struct {
+	Status   string                   `json:"status"`
+	Services map[string]ServiceStatus `json:"services,omitempty"`
+}
 
-	// Get system stats
-	sysStats := h.getSystemStats()
+// HealthCheck reports every registered check. Only failing critical checks
+// turn the response into a 503.
+func (h *HealthHandler) HealthCheck(c *fiber.Ctx) error {
+	services := h.snapshot(c.UserContext())
+	criticalOK, allOK := summarize(services)
 
 	// Determine overall status
-	overallStatus := h.determineOverallStatus(services)
+	overallStatus := "healthy"
+	switch {
+	case h.draining.Load():
+		overallStatus = "draining"
+	case !criticalOK:
+		overallStatus = "unhealthy"
+	case !allOK:
+		overallStatus = "degraded"
+	}
 
 	response := HealthResponse{
 		Status:    overallStatus,
 		Version:   h.cfg.App.Version,
 		Timestamp: time.Now().UTC(),
 		Uptime:    time.Since(h.startTime).Truncate(time.Second).String(),
-		System:    sysStats,
+		System:    h.getSystemStats(),
 		Services:  services,
 	}
 
 	return c.Status(h.statusCode(overallStatus)).JSON(response)
 }
 
-func (h *HealthHandler) checkMySQL(ctx context.Context) string {
-	sqlDB, err := h.mysqlDB.DB()
-	if err != nil {
-		return statusString(err)
+// Liveness only reflects the process itself; dependencies never fail it.
+func (h *HealthHandler) Liveness(c *fiber.Ctx) error {
+	return c.JSON(ProbeResponse{Status: "ok"})
+}
+
+// Readiness fails while starting up, while draining, or when a critical
+// check fails.
+func (h *HealthHandler) Readiness(c *fiber.Ctx) error {
+	if !h.started.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(ProbeResponse{Status: "starting"})
+	}
+	if h.draining.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(ProbeResponse{Status: "draining"})
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
+	services := h.snapshot(c.UserContext())
+	for name, status := range services {
+		if !status.Critical {
+			delete(services, name)
+		}
+	}
 
-	return statusString(sqlDB.PingContext(ctx))
+	if criticalOK, _ := summarize(services); !criticalOK {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(ProbeResponse{Status: "unavailable", Services: services})
+	}
+	return c.JSON(ProbeResponse{Status: "ok", Services: services})
 }
 
-func (h *HealthHandler) checkPostgreSQL(ctx context.Context) string {
-	pgDB, err := h.postgresDB.DB()
-	if err != nil {
-		return statusString(err)
+// Startup succeeds once the server has started listening.
+func (h *HealthHandler) Startup(c *fiber.Ctx) error {
+	if !h.started.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(ProbeResponse{Status: "starting"})
 	}
+	return c.JSON(ProbeResponse{Status: "ok"})
+}
 
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
+// snapshot returns a copy of the cached results, re-running the checks
+// first when the cache is older than the TTL.
+func (h *HealthHandler) snapshot(ctx context.Context) map[string]ServiceStatus {
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	if time.Since(h.lastRefresh) >= h.cacheTTL {
+		h.runChecks(ctx)
+	}
 
-	return statusString(pgDB.PingContext(ctx))
+	services := make(map[string]ServiceStatus, len(h.results))
+	for name, status := range h.results {
+		services[name] = status
+	}
+	return services
 }
 
-func (h *HealthHandler) checkMongoDB(ctx context.Context) string {
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
-	return statusString(h.mongoClient.Ping(ctx, nil))
+func (h *HealthHandler) refresh(ctx context.Context) {
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+	h.runChecks(ctx)
 }
 
-func (h *HealthHandler) checkRedis(ctx context.Context) string {
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+// runChecks runs all registered checkers concurrently and folds the
+// outcomes into the cached results. Callers must hold stateMu.
+func (h *HealthHandler) runChecks(ctx context.Context) {
+	h.mu.RLock()
+	checkers := append([]HealthChecker(nil), h.checkers...)
+	h.mu.RUnlock()
+
+	type outcome struct {
+		checker HealthChecker
+		latency time.Duration
+		at      time.Time
+		err     error
+	}
+
+	outcomes := make([]outcome, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func(i int, checker HealthChecker) {
+			defer wg.Done()
+			start := time.Now()
+			err := h.runCheck(ctx, checker)
+			outcomes[i] = outcome{checker: checker, latency: time.Since(start), at: start.UTC(), err: err}
+		}(i, checker)
+	}
+	wg.Wait()
+
+	results := make(map[string]ServiceStatus, len(outcomes))
+	for _, o := range outcomes {
+		prev := h.results[o.checker.Name()]
+		status := ServiceStatus{
+			Status:              "healthy",
+			Critical:            o.checker.Critical(),
+			LatencyMs:           float64(o.latency.Microseconds()) / 1000,
+			CheckedAt:           o.at,
+			LastSuccess:         prev.LastSuccess,
+			ConsecutiveFailures: prev.ConsecutiveFailures,
+		}
+		if o.err != nil {
+			status.Status = "unhealthy"
+			status.Error = o.err.Error()
+			status.ConsecutiveFailures++
+		} else {
+			at := o.at
+			status.LastSuccess = &at
+			status.ConsecutiveFailures = 0
+		}
+		results[o.checker.Name()] = status
+	}
+
+	h.results = results
+	h.lastRefresh = time.Now()
+}
+
+func (h *HealthHandler) runCheck(ctx context.Context, checker HealthChecker) error {
+	ctx, cancel := context.WithTimeout(ctx, checker.Timeout())
 	defer cancel()
 
-	// Access through the wrapper client
-	_, err := h.redisClient.GetClient().Ping(ctx).Result()
-	return statusString(err)
+	return checker.Check(ctx)
 }
 
 func (h *HealthHandler) getSystemStats() SystemStats {
@@ -150,25 +315,24 @@ func (h *HealthHandler) getSystemStats() SystemStats {
 	}
 }
 
-func (h *HealthHandler) determineOverallStatus(services map[string]string) string {
-	for _, status := range services {
-		if status != "healthy" {
-			return "degraded"
-		}
-	}
-	return "healthy"
-}
-
 func (h *HealthHandler) statusCode(overallStatus string) int {
-	if overallStatus == "degraded" {
+	if overallStatus == "unhealthy" || overallStatus == "draining" {
 		return fiber.StatusServiceUnavailable
 	}
 	return fiber.StatusOK
 }
 
-func statusString(err error) string {
-	if err != nil {
-		return fmt.Sprintf("unhealthy: %v", err)
+// summarize reports whether all critical checks and all checks passed.
+func summarize(services map[string]ServiceStatus) (criticalOK, allOK bool) {
+	criticalOK, allOK = true, true
+	for _, status := range services {
+		if status.Status == "healthy" {
+			continue
+		}
+		allOK = false
+		if status.Critical {
+			criticalOK = false
+		}
 	}
-	return "healthy"
+	return criticalOK, allOK
 }
@@ -0,0 +1,51 @@
+// internal/api/v1/handlers/health_checker.go
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// DefaultCheckTimeout is used for checkers that do not set their own timeout.
+	DefaultCheckTimeout = 2 * time.Second
+	// DefaultCacheTTL is how long check results are served from cache when
+	// health.cache_ttl is unset.
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// HealthChecker is a single dependency probe reported by HealthHandler.
+// Only critical checkers affect readiness; non-critical failures are
+// reported as a degraded status.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+	Critical() bool
+	Timeout() time.Duration
+}
+
+type healthCheck struct {
+	name     string
+	critical bool
+	timeout  time.Duration
+	check    func(ctx context.Context) error
+}
+
+// NewHealthChecker builds a HealthChecker from a check function, e.g. a
+// ping of a downstream HTTP dependency.
+func NewHealthChecker(name string, critical bool, timeout time.Duration, check func(ctx context.Context) error) HealthChecker {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	return &healthCheck{
+		name:     name,
+		critical: critical,
+		timeout:  timeout,
+		check:    check,
+	}
+}
+
+func (c *healthCheck) Name() string                    { return c.name }
+func (c *healthCheck) Check(ctx context.Context) error { return c.check(ctx) }
+func (c *healthCheck) Critical() bool                  { return c.critical }
+func (c *healthCheck) Timeout() time.Duration          { return c.timeout }
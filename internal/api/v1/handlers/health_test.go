@@ -0,0 +1,278 @@
+// internal/api/v1/handlers/health_test.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorbit/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// countingChecker counts its runs and fails while failing is set.
+type countingChecker struct {
+	name     string
+	critical bool
+	delay    time.Duration
+	timeout  time.Duration
+	runs     atomic.Int32
+	failing  atomic.Bool
+}
+
+func (c *countingChecker) Name() string   { return c.name }
+func (c *countingChecker) Critical() bool { return c.critical }
+
+func (c *countingChecker) Timeout() time.Duration {
+	if c.timeout == 0 {
+		return DefaultCheckTimeout
+	}
+	return c.timeout
+}
+
+func (c *countingChecker) Check(ctx context.Context) error {
+	c.runs.Add(1)
+	if c.delay > 0 {
+		select {
+		case <-time.After(c.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if c.failing.Load() {
+		return errors.New(c.name + " is down")
+	}
+	return nil
+}
+
+func healthConfig(cacheTTL, refreshInterval time.Duration) *config.Config {
+	cfg := &config.Config{}
+	cfg.App.Version = "1.2.3"
+	cfg.Health.CacheTTL = cacheTTL
+	cfg.Health.RefreshInterval = refreshInterval
+	return cfg
+}
+
+// get calls handler and decodes its JSON response into v.
+func get(t *testing.T, handler fiber.Handler, v any) int {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", handler)
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestHealthCheckStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		critical    bool
+		optional    bool
+		draining    bool
+		wantStatus  string
+		wantCode    int
+		wantFailing string
+	}{
+		{name: "healthy", wantStatus: "healthy", wantCode: fiber.StatusOK},
+		{name: "optional check failing", optional: true, wantStatus: "degraded", wantCode: fiber.StatusOK, wantFailing: "cache"},
+		{name: "critical check failing", critical: true, wantStatus: "unhealthy", wantCode: fiber.StatusServiceUnavailable, wantFailing: "db"},
+		{name: "draining", draining: true, wantStatus: "draining", wantCode: fiber.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &countingChecker{name: "db", critical: true}
+			cache := &countingChecker{name: "cache"}
+			db.failing.Store(tt.critical)
+			cache.failing.Store(tt.optional)
+
+			h := NewHealthHandler(healthConfig(time.Nanosecond, 0), db, cache)
+			if tt.draining {
+				h.SetDraining()
+			}
+
+			var resp HealthResponse
+			code := get(t, h.HealthCheck, &resp)
+			if code != tt.wantCode || resp.Status != tt.wantStatus {
+				t.Errorf("HealthCheck() = %d %q, want %d %q", code, resp.Status, tt.wantCode, tt.wantStatus)
+			}
+			if resp.Version != "1.2.3" || len(resp.Services) != 2 {
+				t.Errorf("HealthCheck() = %+v", resp)
+			}
+			for name, status := range resp.Services {
+				if failing := name == tt.wantFailing; failing != (status.Status == "unhealthy") || failing != (status.Error != "") {
+					t.Errorf("service %s = %+v", name, status)
+				}
+			}
+			if !resp.Services["db"].Critical || resp.Services["cache"].Critical {
+				t.Errorf("critical flags = %+v", resp.Services)
+			}
+		})
+	}
+}
+
+func TestHealthCheckCache(t *testing.T) {
+	db := &countingChecker{name: "db", critical: true}
+	h := NewHealthHandler(healthConfig(time.Hour, 0), db)
+
+	var resp HealthResponse
+	for i := 0; i < 3; i++ {
+		get(t, h.HealthCheck, &resp)
+	}
+	if runs := db.runs.Load(); runs != 1 {
+		t.Errorf("checker ran %d times within the cache TTL, want 1", runs)
+	}
+
+	// Registering a checker invalidates the cache
+	cache := &countingChecker{name: "cache"}
+	h.Register(cache)
+	get(t, h.HealthCheck, &resp)
+	if db.runs.Load() != 2 || cache.runs.Load() != 1 || len(resp.Services) != 2 {
+		t.Errorf("after Register: runs %d, %d; services %v", db.runs.Load(), cache.runs.Load(), resp.Services)
+	}
+
+	h = NewHealthHandler(healthConfig(time.Millisecond, 0), db)
+	get(t, h.HealthCheck, &resp)
+	time.Sleep(5 * time.Millisecond)
+	get(t, h.HealthCheck, &resp)
+	if runs := db.runs.Load(); runs != 4 {
+		t.Errorf("checker ran %d times, want a run per expired cache", runs-2)
+	}
+}
+
+func TestHealthCheckFailureHistory(t *testing.T) {
+	db := &countingChecker{name: "db", critical: true}
+	h := NewHealthHandler(healthConfig(time.Hour, 0), db)
+
+	h.refresh(context.Background())
+	success := h.results["db"].LastSuccess
+	if success == nil {
+		t.Fatal("LastSuccess not set after a successful check")
+	}
+
+	db.failing.Store(true)
+	h.refresh(context.Background())
+	h.refresh(context.Background())
+	status := h.results["db"]
+	if status.ConsecutiveFailures != 2 || status.LastSuccess == nil || !status.LastSuccess.Equal(*success) {
+		t.Errorf("after two failures = %+v, want 2 failures since %v", status, success)
+	}
+
+	db.failing.Store(false)
+	h.refresh(context.Background())
+	if status := h.results["db"]; status.ConsecutiveFailures != 0 || !status.LastSuccess.After(*success) {
+		t.Errorf("after recovering = %+v", status)
+	}
+}
+
+func TestHealthCheckConcurrentWithTimeouts(t *testing.T) {
+	slow := []*countingChecker{
+		{name: "db", critical: true, delay: 200 * time.Millisecond},
+		{name: "cache", delay: 200 * time.Millisecond},
+		{name: "search", delay: 200 * time.Millisecond},
+	}
+	hung := &countingChecker{name: "payments", delay: time.Hour, timeout: 50 * time.Millisecond}
+	h := NewHealthHandler(healthConfig(0, 0), slow[0], slow[1], slow[2], hung)
+
+	start := time.Now()
+	var resp HealthResponse
+	get(t, h.HealthCheck, &resp)
+	elapsed := time.Since(start)
+
+	// Run one after the other the checks would take 650ms
+	if elapsed > 400*time.Millisecond {
+		t.Errorf("checks took %v, want them to run concurrently", elapsed)
+	}
+	status := resp.Services["payments"]
+	if status.Status != "unhealthy" || status.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("hung check = %+v, want a timeout", status)
+	}
+	if resp.Status != "degraded" {
+		t.Errorf("status = %q, want degraded by the non-critical timeout", resp.Status)
+	}
+}
+
+func TestHealthRefresher(t *testing.T) {
+	db := &countingChecker{name: "db", critical: true}
+	h := NewHealthHandler(healthConfig(time.Hour, 10*time.Millisecond), db)
+
+	h.StartRefresher()
+	deadline := time.Now().Add(2 * time.Second)
+	for db.runs.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := h.StopRefresher(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	runs := db.runs.Load()
+	if runs < 3 {
+		t.Fatalf("refresher ran the checks %d times, want at least 3", runs)
+	}
+
+	// Probes are served from the refreshed cache
+	var resp HealthResponse
+	get(t, h.HealthCheck, &resp)
+	time.Sleep(30 * time.Millisecond)
+	if db.runs.Load() != runs {
+		t.Errorf("checks ran %d times after StopRefresher and a cached probe", db.runs.Load()-runs)
+	}
+	if err := h.StopRefresher(context.Background()); err != nil {
+		t.Errorf("second StopRefresher() = %v", err)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	db := &countingChecker{name: "db", critical: true}
+	cache := &countingChecker{name: "cache"}
+	cache.failing.Store(true)
+	h := NewHealthHandler(healthConfig(time.Nanosecond, 0), db, cache)
+
+	probe := func(handler fiber.Handler) (int, ProbeResponse) {
+		var resp ProbeResponse
+		code := get(t, handler, &resp)
+		return code, resp
+	}
+
+	if code, resp := probe(h.Startup); code != fiber.StatusServiceUnavailable || resp.Status != "starting" {
+		t.Errorf("Startup() before MarkStarted = %d %q", code, resp.Status)
+	}
+	if code, resp := probe(h.Readiness); code != fiber.StatusServiceUnavailable || resp.Status != "starting" {
+		t.Errorf("Readiness() before MarkStarted = %d %q", code, resp.Status)
+	}
+	if code, _ := probe(h.Liveness); code != fiber.StatusOK {
+		t.Errorf("Liveness() = %d", code)
+	}
+
+	h.MarkStarted()
+	if code, _ := probe(h.Startup); code != fiber.StatusOK {
+		t.Errorf("Startup() = %d", code)
+	}
+	// Only critical checks count, and only they are reported
+	code, resp := probe(h.Readiness)
+	if _, ok := resp.Services["cache"]; code != fiber.StatusOK || resp.Status != "ok" || ok {
+		t.Errorf("Readiness() = %d %+v", code, resp)
+	}
+
+	db.failing.Store(true)
+	if code, resp := probe(h.Readiness); code != fiber.StatusServiceUnavailable || resp.Status != "unavailable" || resp.Services["db"].Error == "" {
+		t.Errorf("Readiness() with a failing critical check = %d %+v", code, resp)
+	}
+
+	h.SetDraining()
+	if code, resp := probe(h.Readiness); code != fiber.StatusServiceUnavailable || resp.Status != "draining" {
+		t.Errorf("Readiness() while draining = %d %q", code, resp.Status)
+	}
+	if code, _ := probe(h.Liveness); code != fiber.StatusOK {
+		t.Errorf("Liveness() while draining = %d", code)
+	}
+}
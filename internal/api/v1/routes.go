@@ -2,17 +2,28 @@ package v1
 
 import (
 	"gorbit/internal/api/v1/handlers"
+	"gorbit/internal/config"
+	"gorbit/internal/database"
+	"gorbit/internal/middleware"
+	"gorbit/internal/outbox"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func RegisterRoutes(router fiber.Router, healthHandler *handlers.HealthHandler) {
+func RegisterRoutes(router fiber.Router, store *config.Store, datastores *database.Registry, healthHandler *handlers.HealthHandler, relay *outbox.Relay) {
 	// Health Check
 	// router.Get("/health", healthHandler.HealthCheck)
 	v1Group := router.Group("/v1")
 	v1Group.Get("/health", healthHandler.HealthCheck)
 	v1Group.Get("/random", handlers.GetRandomNumber)
 
+	// Admin
+	adminHandler := handlers.NewAdminHandler(store, relay)
+	admin := v1Group.Group("/admin", middleware.APIKeyAuth(store))
+	admin.Get("/config/reloads", adminHandler.ConfigReloads)
+	admin.Post("/config/reload", adminHandler.ReloadConfig)
+	admin.Get("/outbox", adminHandler.OutboxStats)
+
 	// Add other routes here
 	// router.Get("/users", handlers.GetUsers)
 }
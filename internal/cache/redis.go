@@ -3,39 +3,151 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"gorbit/internal/config"
+	"gorbit/internal/database"
+	"gorbit/pkg/utils"
 
 	"github.com/go-redis/redis/v8"
 )
 
 // RedisClient wraps the redis client with our own methods
 type RedisClient struct {
-	client *redis.Client
+	client redis.UniversalClient
 	cfg    *config.Config
 }
 
-func (rc *RedisClient) Ping(ctx context.Context) {
-	panic("unimplemented")
+// RedisDriver is the registry name of the Redis datastore.
+const RedisDriver = "redis"
+
+func init() {
+	database.Register(database.Driver{
+		Name:     RedisDriver,
+		Order:    40,
+		Critical: false,
+		Enabled: func(cfg *config.Config) bool {
+			return cfg.Redis.Enabled
+		},
+		Open: func(ctx context.Context, cfg *config.Config) (database.Store, error) {
+			rc, err := NewRedisClient(cfg)
+			if err != nil {
+				return nil, database.Permanent(err)
+			}
+			if err := rc.Connect(ctx); err != nil {
+				_ = rc.Close()
+				return nil, err
+			}
+			return &redisStore{rc}, nil
+		},
+		Retry: func(cfg *config.Config) config.RetryPolicy {
+			return cfg.Redis.Retry
+		},
+	})
+}
+
+// redisStore adapts a RedisClient to the database.Store interface.
+type redisStore struct {
+	*RedisClient
+}
+
+func (s *redisStore) Close(ctx context.Context) error {
+	return s.RedisClient.Close()
+}
+
+// FromRegistry returns the Redis client opened by the datastore registry.
+func FromRegistry(r *database.Registry) (*RedisClient, bool) {
+	store, ok := r.Get(RedisDriver)
+	if !ok {
+		return nil, false
+	}
+	rs, ok := store.(*redisStore)
+	if !ok {
+		return nil, false
+	}
+	return rs.RedisClient, true
 }
 
-// NewRedisClient creates a new Redis client wrapper
-func NewRedisClient(cfg *config.Config) *RedisClient {
-	return &RedisClient{
-		client: redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
-			Password: cfg.Redis.Password,
-			DB:       cfg.Redis.DB,
-		}),
-		cfg: cfg,
+// NewRedisClient creates a new Redis client wrapper for the configured
+// mode: a single server, a Sentinel-managed master or a cluster.
+func NewRedisClient(cfg *config.Config) (*RedisClient, error) {
+	c := cfg.Redis
+	opts := &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		DB:               c.DB,
+		Username:         c.Username,
+		Password:         c.Password,
+		SentinelUsername: c.SentinelUsername,
+		SentinelPassword: c.SentinelPassword,
+		MasterName:       c.MasterName,
+		MaxRetries:       c.MaxRetries,
+		DialTimeout:      c.DialTimeout,
+		ReadTimeout:      c.ReadTimeout,
+		WriteTimeout:     c.WriteTimeout,
+		PoolSize:         c.PoolSize,
+		MinIdleConns:     c.MinIdleConns,
+		PoolTimeout:      c.PoolTimeout,
+		IdleTimeout:      c.IdleTimeout,
+		MaxConnAge:       c.MaxConnAge,
+		ReadOnly:         c.ReadOnly,
+		RouteByLatency:   c.RouteByLatency,
+		RouteRandomly:    c.RouteRandomly,
+	}
+	if c.TLS || c.TLSCAFile != "" || c.TLSCertFile != "" {
+		tlsConfig, err := utils.LoadTLSConfig(c.TLSCAFile, c.TLSCertFile, c.TLSKeyFile, c.TLSInsecure)
+		if err != nil {
+			return nil, fmt.Errorf("redis tls: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	// The mode is chosen explicitly rather than from the number of
+	// addresses, so a cluster can be reached through a single seed node
+	var client redis.UniversalClient
+	switch c.Mode {
+	case "", "standalone":
+		if c.Host == "" {
+			return nil, errors.New("redis: host is required in standalone mode")
+		}
+		port := c.Port
+		if port == 0 {
+			port = 6379
+		}
+		opts.Addrs = []string{net.JoinHostPort(c.Host, strconv.Itoa(port))}
+		client = redis.NewClient(opts.Simple())
+	case "sentinel":
+		if c.MasterName == "" || len(c.Addrs) == 0 {
+			return nil, errors.New("redis: master_name and addrs are required in sentinel mode")
+		}
+		client = redis.NewFailoverClient(opts.Failover())
+	case "cluster":
+		if len(c.Addrs) == 0 {
+			return nil, errors.New("redis: addrs are required in cluster mode")
+		}
+		client = redis.NewClusterClient(opts.Cluster())
+	default:
+		return nil, fmt.Errorf("redis: unknown mode %q", c.Mode)
 	}
+
+	return &RedisClient{client: client, cfg: cfg}, nil
+}
+
+// Ping checks that the server is reachable
+func (rc *RedisClient) Ping(ctx context.Context) error {
+	return rc.client.Ping(ctx).Err()
 }
 
-// Connect verifies the connection and returns any error
-func (rc *RedisClient) Connect() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Connect verifies the connection within ctx and returns any error
+func (rc *RedisClient) Connect(ctx context.Context) error {
+	timeout := 5 * time.Second
+	if rc.cfg.Redis.DialTimeout > timeout {
+		timeout = rc.cfg.Redis.DialTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	_, err := rc.client.Ping(ctx).Result()
@@ -45,8 +157,9 @@ func (rc *RedisClient) Connect() error {
 	return nil
 }
 
-// GetClient returns the underlying redis client
-func (rc *RedisClient) GetClient() *redis.Client {
+// GetClient returns the underlying client; its concrete type depends on
+// the configured mode.
+func (rc *RedisClient) GetClient() redis.UniversalClient {
 	return rc.client
 }
 
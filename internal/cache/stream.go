@@ -0,0 +1,66 @@
+// internal/cache/stream.go
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"gorbit/internal/config"
+	"gorbit/internal/outbox"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// StreamPublisher publishes outbox events to Redis Streams, each to the
+// stream named by its topic and the configured prefix. Entries carry the
+// event ID for consumers to skip redelivered events.
+type StreamPublisher struct {
+	client     redis.UniversalClient
+	prefix     string
+	deadLetter string
+	maxLen     int64
+}
+
+// NewStreamPublisher returns a publisher writing through rc.
+func NewStreamPublisher(rc *RedisClient, cfg config.Outbox) *StreamPublisher {
+	return &StreamPublisher{
+		client:     rc.GetClient(),
+		prefix:     cfg.StreamPrefix,
+		deadLetter: cfg.DeadLetterStream,
+		maxLen:     cfg.MaxLen,
+	}
+}
+
+// Publish adds e to the stream of its topic.
+func (p *StreamPublisher) Publish(ctx context.Context, e outbox.Event) error {
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.prefix + e.Topic,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: streamValues(e),
+	}).Err()
+}
+
+// DeadLetter adds e to the dead letter stream with the attempts made and
+// the last error.
+func (p *StreamPublisher) DeadLetter(ctx context.Context, e outbox.Event, cause error) error {
+	values := append(streamValues(e),
+		"attempts", strconv.Itoa(e.Attempts),
+		"error", cause.Error(),
+	)
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.deadLetter,
+		Values: values,
+	}).Err()
+}
+
+func streamValues(e outbox.Event) []any {
+	return []any{
+		"id", strconv.FormatUint(e.ID, 10),
+		"topic", e.Topic,
+		"key", e.Key,
+		"payload", e.Payload,
+		"created_at", e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
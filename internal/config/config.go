@@ -2,7 +2,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -10,103 +16,493 @@ import (
 
 type Config struct {
 	Server struct {
-		Port  int    `mapstructure:"port"`
-		Host  string `mapstructure:"host"`
-		Debug bool   `mapstructure:"debug"`
+		Port            int           `mapstructure:"port" validate:"required,min=1,max=65535"`
+		Host            string        `mapstructure:"host" validate:"required,hostname"`
+		Debug           bool          `mapstructure:"debug"`
+		ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" validate:"min=0"`
+		CloseTimeout    time.Duration `mapstructure:"close_timeout" validate:"min=0"`
 	} `mapstructure:"server"`
 
+	Log struct {
+		Level  string `mapstructure:"level" validate:"oneof=debug info warn error"`
+		Format string `mapstructure:"format" validate:"oneof=text json"`
+	} `mapstructure:"log"`
+
+	CORS struct {
+		AllowOrigins     []string `mapstructure:"allow_origins"`
+		AllowCredentials bool     `mapstructure:"allow_credentials"`
+	} `mapstructure:"cors"`
+
+	Health struct {
+		CacheTTL        time.Duration `mapstructure:"cache_ttl" validate:"min=0"`
+		RefreshInterval time.Duration `mapstructure:"refresh_interval" validate:"min=0"`
+	} `mapstructure:"health"`
+
 	App struct {
-		Name      string `mapstructure:"name"`
+		Name      string `mapstructure:"name" validate:"required"`
 		Version   string `mapstructure:"version"`
-		Env       string `yaml:"env"`
-		APIKey    string `mapstructure:"api_key"`
-		JWTSecret string `mapstructure:"jwt_secret"`
+		Env       string `mapstructure:"env"`
+		APIKey    string `mapstructure:"api_key" validate:"noplaceholder"`
+		JWTSecret string `mapstructure:"jwt_secret" validate:"required,min=16,noplaceholder"`
 	} `mapstructure:"app"`
 
 	Databases struct {
-		MySQL struct {
-			Host            string        `mapstructure:"host"`
-			Port            int           `mapstructure:"port"`
-			Username        string        `mapstructure:"username"`
-			Password        string        `mapstructure:"password"`
-			Database        string        `mapstructure:"database"`
-			MaxOpenConns    int           `mapstructure:"max_open_conns"`
-			MaxIdleConns    int           `mapstructure:"max_idle_conns"`
-			ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
-		} `mapstructure:"mysql"`
-
-		Postgres struct {
-			Host     string `mapstructure:"host"`
-			Port     int    `mapstructure:"port"`
-			Username string `mapstructure:"username"`
-			Password string `mapstructure:"password"`
-			Database string `mapstructure:"database"`
-		} `mapstructure:"postgres"`
-
-		MongoDB struct {
-			Host          string `mapstructure:"host"`
-			Port          int    `mapstructure:"port"`
-			Username      string `mapstructure:"username"`
-			Password      string `mapstructure:"password"`
-			Database      string `mapstructure:"database"`
-			AuthSource    string `mapstructure:"auth_source"`
-			AuthMechanism string `mapstructure:"auth_mechanism"`
-		} `mapstructure:"mongodb"`
+		// MigrateOnStart applies pending migrations from MigrationsDir at startup
+		MigrateOnStart bool   `mapstructure:"migrate_on_start"`
+		MigrationsDir  string `mapstructure:"migrations_dir"`
+
+		MySQL    SQLDatabase `mapstructure:"mysql"`
+		Postgres SQLDatabase `mapstructure:"postgres"`
+
+		MongoDB MongoDatabase `mapstructure:"mongodb"`
+
+		QueryLog QueryLog `mapstructure:"query_log"`
 	} `mapstructure:"databases"`
 
 	Redis struct {
-		Host     string `mapstructure:"host"`
-		Port     int    `mapstructure:"port"`
+		Enabled bool `mapstructure:"enabled"`
+		// Mode is standalone (default), sentinel or cluster
+		Mode string `mapstructure:"mode" validate:"oneof=standalone sentinel cluster"`
+		// Host and Port address a standalone server
+		Host string `mapstructure:"host" validate:"hostname"`
+		Port int    `mapstructure:"port" validate:"min=0,max=65535"`
+		// Addrs are the sentinels, or the cluster seed nodes, as host:port
+		Addrs            []string `mapstructure:"addrs"`
+		MasterName       string   `mapstructure:"master_name"`
+		SentinelUsername string   `mapstructure:"sentinel_username"`
+		SentinelPassword string   `mapstructure:"sentinel_password"`
+
+		Username string `mapstructure:"username"`
 		Password string `mapstructure:"password"`
-		DB       int    `mapstructure:"db"`
+		DB       int    `mapstructure:"db" validate:"min=0,max=15"`
+
+		TLS         bool   `mapstructure:"tls"`
+		TLSCAFile   string `mapstructure:"tls_ca_file"`
+		TLSCertFile string `mapstructure:"tls_cert_file"`
+		TLSKeyFile  string `mapstructure:"tls_key_file"`
+		TLSInsecure bool   `mapstructure:"tls_insecure"`
+
+		DialTimeout  time.Duration `mapstructure:"dial_timeout" validate:"min=0"`
+		ReadTimeout  time.Duration `mapstructure:"read_timeout" validate:"min=0"`
+		WriteTimeout time.Duration `mapstructure:"write_timeout" validate:"min=0"`
+
+		PoolSize     int           `mapstructure:"pool_size" validate:"min=0"`
+		MinIdleConns int           `mapstructure:"min_idle_conns" validate:"min=0"`
+		MaxRetries   int           `mapstructure:"max_retries" validate:"min=-1"`
+		PoolTimeout  time.Duration `mapstructure:"pool_timeout" validate:"min=0"`
+		IdleTimeout  time.Duration `mapstructure:"idle_timeout" validate:"min=0"`
+		MaxConnAge   time.Duration `mapstructure:"max_conn_age" validate:"min=0"`
+
+		// ReadOnly, RouteByLatency and RouteRandomly send cluster reads to
+		// replicas
+		ReadOnly       bool `mapstructure:"read_only"`
+		RouteByLatency bool `mapstructure:"route_by_latency"`
+		RouteRandomly  bool `mapstructure:"route_randomly"`
+
+		Retry RetryPolicy `mapstructure:"retry"`
 	} `mapstructure:"redis"`
+
+	// Outbox relays the events of the outbox table to Redis Streams
+	Outbox Outbox `mapstructure:"outbox"`
+
+	RateLimit struct {
+		Enabled bool          `mapstructure:"enabled"`
+		Max     int           `mapstructure:"max" validate:"required,min=1"`
+		Window  time.Duration `mapstructure:"window" validate:"required,min=0"`
+	} `mapstructure:"rate_limit"`
+
+	// Features are named on/off toggles, see Feature
+	Features map[string]bool `mapstructure:"features"`
+
+	Secrets struct {
+		Vault struct {
+			Address   string        `mapstructure:"address"`
+			Token     string        `mapstructure:"token"`
+			Namespace string        `mapstructure:"namespace"`
+			Timeout   time.Duration `mapstructure:"timeout" validate:"min=0"`
+		} `mapstructure:"vault"`
+	} `mapstructure:"secrets"`
+
+	// sources maps each key to where its value was loaded from
+	sources map[string]string
+	// secrets marks keys whose value was resolved from a secret reference
+	secrets map[string]bool
+}
+
+// Outbox configures the relay of the outbox_events table to Redis Streams.
+type Outbox struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Store is the SQL datastore holding the outbox_events table
+	Store string `mapstructure:"store" validate:"required,oneof=mysql postgres"`
+	// StreamPrefix is prepended to the topic of an event to name its
+	// stream
+	StreamPrefix     string `mapstructure:"stream_prefix"`
+	DeadLetterStream string `mapstructure:"dead_letter_stream" validate:"required"`
+	// MaxLen caps each stream approximately; 0 keeps every entry
+	MaxLen       int64         `mapstructure:"max_len" validate:"min=0"`
+	PollInterval time.Duration `mapstructure:"poll_interval" validate:"required,min=0"`
+	BatchSize    int           `mapstructure:"batch_size" validate:"required,min=1"`
+	// Retry schedules the attempts to publish an event; it is
+	// dead-lettered once they are used up or its timeout has passed
+	Retry RetryPolicy `mapstructure:"retry"`
+}
+
+// SQLDatabase configures a MySQL or PostgreSQL connection. Both drivers
+// interpret every key the same way.
+type SQLDatabase struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Host     string `mapstructure:"host" validate:"required,hostname"`
+	Port     int    `mapstructure:"port" validate:"required,min=1,max=65535"`
+	Username string `mapstructure:"username" validate:"required"`
+	Password string `mapstructure:"password"`
+	Database string `mapstructure:"database" validate:"required"`
+
+	// SSLMode follows the PostgreSQL modes: disable, prefer, require,
+	// verify-ca (verify the server certificate) or verify-full (and its
+	// host name)
+	SSLMode     string `mapstructure:"sslmode" validate:"oneof=disable prefer require verify-ca verify-full"`
+	SSLRootCert string `mapstructure:"sslrootcert"`
+	SSLCert     string `mapstructure:"sslcert"`
+	SSLKey      string `mapstructure:"sslkey"`
+
+	// Timezone is the session time zone, also used to read timestamps
+	Timezone         string        `mapstructure:"timezone"`
+	ConnectTimeout   time.Duration `mapstructure:"connect_timeout" validate:"min=0"`
+	StatementTimeout time.Duration `mapstructure:"statement_timeout" validate:"min=0"`
+	ApplicationName  string        `mapstructure:"application_name"`
+	// Params are passed to the driver as additional DSN parameters
+	Params map[string]string `mapstructure:"params"`
+
+	MaxOpenConns    int           `mapstructure:"max_open_conns" validate:"min=0"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns" validate:"min=0"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime" validate:"min=0"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time" validate:"min=0"`
+
+	// Replicas are read replicas as host or host:port, sharing every other
+	// setting above. Reads outside transactions go to a healthy replica
+	Replicas []string `mapstructure:"replicas"`
+	// ReplicaPolicy picks the replica for a read: round_robin (default) or
+	// least_latency
+	ReplicaPolicy string `mapstructure:"replica_policy" validate:"oneof=round_robin least_latency"`
+	// MaxReplicaLag takes replicas further behind the primary out of
+	// rotation; 0 skips the lag check
+	MaxReplicaLag        time.Duration `mapstructure:"max_replica_lag" validate:"min=0"`
+	ReplicaCheckInterval time.Duration `mapstructure:"replica_check_interval" validate:"min=0"`
+
+	Retry RetryPolicy `mapstructure:"retry"`
 }
 
-func LoadConfig() (*Config, error) {
-	// Set the configuration file name and path
-	configPath := "configs"
+// QueryLog controls how the SQL stores log their statements. Every
+// statement is logged at debug level, failed ones as errors.
+type QueryLog struct {
+	// SlowThreshold logs slower statements as warnings; 0 disables it
+	SlowThreshold time.Duration `mapstructure:"slow_threshold" validate:"min=0"`
+	// Explain logs the query plan of slow statements, in the background
+	Explain bool `mapstructure:"explain"`
+	// RedactColumns adds to the column name fragments (password, secret,
+	// token, api_key) whose bound values are masked
+	RedactColumns []string `mapstructure:"redact_columns"`
+}
+
+// MongoDatabase configures the MongoDB client.
+type MongoDatabase struct {
+	Enabled bool `mapstructure:"enabled"`
+	// URI is a full mongodb:// or mongodb+srv:// connection string;
+	// the keys below override the options it sets
+	URI string `mapstructure:"uri"`
+	// Host and Port, or Hosts as host:port pairs, are used without URI.
+	// With SRV set, Host is resolved as a mongodb+srv:// name
+	Host       string   `mapstructure:"host" validate:"hostname"`
+	Port       int      `mapstructure:"port" validate:"min=0,max=65535"`
+	Hosts      []string `mapstructure:"hosts"`
+	SRV        bool     `mapstructure:"srv"`
+	ReplicaSet string   `mapstructure:"replica_set"`
+
+	Username      string `mapstructure:"username"`
+	Password      string `mapstructure:"password"`
+	Database      string `mapstructure:"database" validate:"required"`
+	AuthSource    string `mapstructure:"auth_source"`
+	AuthMechanism string `mapstructure:"auth_mechanism"`
 
-	// Initialize Viper
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(configPath)
+	TLS         bool   `mapstructure:"tls"`
+	TLSCAFile   string `mapstructure:"tls_ca_file"`
+	TLSCertFile string `mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `mapstructure:"tls_key_file"`
+	TLSInsecure bool   `mapstructure:"tls_insecure"`
+
+	MinPoolSize            uint64        `mapstructure:"min_pool_size"`
+	MaxPoolSize            uint64        `mapstructure:"max_pool_size"`
+	MaxConnIdleTime        time.Duration `mapstructure:"max_conn_idle_time" validate:"min=0"`
+	ConnectTimeout         time.Duration `mapstructure:"connect_timeout" validate:"min=0"`
+	ServerSelectionTimeout time.Duration `mapstructure:"server_selection_timeout" validate:"min=0"`
+
+	ReadPreference string `mapstructure:"read_preference" validate:"oneof=primary primaryPreferred secondary secondaryPreferred nearest"`
+	ReadConcern    string `mapstructure:"read_concern" validate:"oneof=local available majority linearizable snapshot"`
+	// WriteConcern is "majority", a tag set name or a number of nodes
+	WriteConcern string        `mapstructure:"write_concern"`
+	WriteJournal bool          `mapstructure:"write_journal"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout" validate:"min=0"`
+	// Compressors lists snappy, zlib or zstd in order of preference
+	Compressors []string `mapstructure:"compressors"`
+
+	Retry RetryPolicy `mapstructure:"retry"`
+}
+
+// RetryPolicy controls how often a datastore connection is attempted at
+// startup. Waits start at InitialBackoff and double up to MaxBackoff.
+type RetryPolicy struct {
+	// MaxAttempts of 0 or 1 connects once without retrying
+	MaxAttempts    int           `mapstructure:"max_attempts" validate:"min=0"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" validate:"min=0"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff" validate:"min=0"`
+	// Jitter varies each wait randomly by up to this fraction of it
+	Jitter float64 `mapstructure:"jitter" validate:"min=0,max=1"`
+	// Timeout bounds all attempts together; 0 leaves them unbounded
+	Timeout time.Duration `mapstructure:"timeout" validate:"min=0"`
+}
 
-	// Read the primary configuration
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+const (
+	// EnvPrefix prefixes environment variables overriding config keys, e.g.
+	// GORBIT_DATABASES_MYSQL_PASSWORD for databases.mysql.password.
+	EnvPrefix = "GORBIT"
+	// ConfigDirEnv relocates the configuration directory.
+	ConfigDirEnv = "GORBIT_CONFIG_DIR"
+	// DefaultConfigDir is used when neither an option nor ConfigDirEnv is set.
+	DefaultConfigDir = "configs"
+)
+
+// configFiles are merged in order from the configuration directory. Only
+// config.yaml is mandatory; services without datastores may omit the rest.
+var configFiles = []string{"config", "database", "redis"}
+
+type options struct {
+	dir        string
+	env        string
+	overrides  map[string]string
+	providers  map[string]SecretProvider
+	novalidate bool
+}
+
+// Option customizes LoadConfig.
+type Option func(*options)
+
+// WithConfigDir reads the configuration files from dir. It takes precedence
+// over GORBIT_CONFIG_DIR; an empty dir is ignored.
+func WithConfigDir(dir string) Option {
+	return func(o *options) {
+		if dir != "" {
+			o.dir = dir
+		}
 	}
+}
 
-	// Read database configuration
-	databaseViper := viper.New()
-	databaseViper.SetConfigName("database")
-	databaseViper.SetConfigType("yaml")
-	databaseViper.AddConfigPath(configPath)
-	if err := databaseViper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error reading database config file: %w", err)
+// WithEnv selects the configuration profile, taking precedence over
+// GORBIT_ENV and app.env; an empty env is ignored.
+func WithEnv(env string) Option {
+	return func(o *options) {
+		if env != "" {
+			o.env = env
+		}
 	}
+}
 
-	// Read Redis configuration
-	redisViper := viper.New()
-	redisViper.SetConfigName("redis")
-	redisViper.SetConfigType("yaml")
-	redisViper.AddConfigPath(configPath)
-	if err := redisViper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error reading redis config file: %w", err)
+// SkipValidation returns the configuration even if it breaks the validate
+// rules, e.g. to print or compare it.
+func SkipValidation() Option {
+	return func(o *options) {
+		o.novalidate = true
 	}
+}
 
-	// Merge configurations
-	for k, v := range databaseViper.AllSettings() {
-		viper.Set(k, v)
+// WithOverrides sets config keys (e.g. "server.port") to the given values,
+// taking precedence over files and environment variables. It is meant for
+// command-line flags.
+func WithOverrides(overrides map[string]string) Option {
+	return func(o *options) {
+		if o.overrides == nil {
+			o.overrides = make(map[string]string)
+		}
+		for k, v := range overrides {
+			o.overrides[strings.ToLower(k)] = v
+		}
 	}
-	for k, v := range redisViper.AllSettings() {
-		viper.Set(k, v)
+}
+
+// Overrides collects repeated --set key=value command-line flags for
+// WithOverrides. Values may contain commas and equals signs.
+type Overrides map[string]string
+
+func (o Overrides) String() string {
+	pairs := make([]string, 0, len(o))
+	for k, v := range o {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (o Overrides) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	o[key] = val
+	return nil
+}
+
+// Type names the flag value in pflag usage messages.
+func (o Overrides) Type() string {
+	return "key=value"
+}
+
+func newOptions(opts []Option) options {
+	o := options{dir: os.Getenv(ConfigDirEnv)}
+	if o.dir == "" {
+		o.dir = DefaultConfigDir
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// LoadConfig reads config.yaml, database.yaml and redis.yaml from the
+// configuration directory and merges them key by key, then overlays the
+// optional config.<env>.yaml, database.<env>.yaml and redis.<env>.yaml of
+// the active profile. Values are then overridden by GORBIT_-prefixed
+// environment variables and finally by WithOverrides. Keys set nowhere fall
+// back to the defaults of the active profile. Secret references are
+// resolved before the result is validated.
+func LoadConfig(opts ...Option) (*Config, error) {
+	o := newOptions(opts)
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	sources := make(map[string]string)
+
+	// Deep-merge each file so nested sections are combined, not replaced
+	for i, name := range configFiles {
+		path := filepath.Join(o.dir, name+".yaml")
+		if _, err := os.Stat(path); i > 0 && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := mergeFile(v, path, sources); err != nil {
+			return nil, fmt.Errorf("error reading %s config file: %w", name, err)
+		}
+	}
+
+	// Environment overrides; every known key is bound so that keys missing
+	// from the files can still be set from the environment
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for _, key := range Keys() {
+		if err := v.BindEnv(key); err != nil {
+			return nil, fmt.Errorf("error binding environment for %s: %w", key, err)
+		}
+	}
+
+	// Profile overlays, deep-merged over the base files
+	env := normalizeEnv(resolveEnv(v, o))
+	for _, name := range configFiles {
+		path := filepath.Join(o.dir, name+"."+env+".yaml")
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := mergeFile(v, path, sources); err != nil {
+			return nil, fmt.Errorf("error reading %s %s config file: %w", env, name, err)
+		}
+	}
+	for k, val := range defaultsFor(env) {
+		v.SetDefault(k, val)
+		if _, ok := sources[k]; !ok {
+			sources[k] = "profile default (" + env + ")"
+		}
+	}
+	for _, key := range Keys() {
+		if name := EnvName(key); os.Getenv(name) != "" {
+			sources[key] = "env " + name
+		}
+	}
+
+	// Command-line overrides
+	for k, val := range o.overrides {
+		v.Set(k, val)
+		sources[k] = "command line"
 	}
+	v.Set("app.env", env)
 
 	// Unmarshal configuration
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("unable to decode config into struct: %w", err)
 	}
+	config.sources = sources
+
+	// Resolve file://, env://, vault:// and custom secret references
+	if err := resolveSecrets(&config, o.providers); err != nil {
+		return nil, err
+	}
+
+	if !o.novalidate {
+		if err := Validate(&config); err != nil {
+			return nil, err
+		}
+	}
 
 	return &config, nil
 }
+
+// mergeFile deep-merges a YAML file into v and records it as the source of
+// every key it sets.
+func mergeFile(v *viper.Viper, path string, sources map[string]string) error {
+	fileViper := viper.New()
+	fileViper.SetConfigFile(path)
+	if err := fileViper.ReadInConfig(); err != nil {
+		return err
+	}
+	for _, key := range fileViper.AllKeys() {
+		sources[key] = path
+	}
+
+	v.SetConfigFile(path)
+	return v.MergeInConfig()
+}
+
+// EnvName returns the environment variable overriding key, e.g.
+// GORBIT_DATABASES_MYSQL_PASSWORD for databases.mysql.password.
+func EnvName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Source returns where the value of key came from: a file path, an
+// environment variable, the command line or a profile default.
+func (c *Config) Source(key string) string {
+	if src, ok := c.sources[key]; ok {
+		return src
+	}
+	return "not set"
+}
+
+// resolveEnv picks the active profile: WithEnv, an app.env override,
+// GORBIT_ENV, then app.env from the base files or GORBIT_APP_ENV.
+func resolveEnv(v *viper.Viper, o options) string {
+	if o.env != "" {
+		return o.env
+	}
+	if env := o.overrides["app.env"]; env != "" {
+		return env
+	}
+	if env := os.Getenv(EnvVar); env != "" {
+		return env
+	}
+	if env := v.GetString("app.env"); env != "" {
+		return env
+	}
+	return DefaultEnv
+}
+
+// Feature reports whether the named feature toggle is on.
+func (c *Config) Feature(name string) bool {
+	return c.Features[strings.ToLower(name)]
+}
@@ -0,0 +1,50 @@
+// internal/config/config_test.go
+package config
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestOverrides(t *testing.T) {
+	overrides := Overrides{}
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(overrides, "set", "")
+
+	err := fs.Parse([]string{
+		"--set", "server.port=9090",
+		"--set", "cors.allow_origins=https://a.example.com,https://b.example.com",
+		"--set", "databases.postgres.params.options=-c search_path=app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Overrides{
+		"server.port":                       "9090",
+		"cors.allow_origins":                "https://a.example.com,https://b.example.com",
+		"databases.postgres.params.options": "-c search_path=app",
+	}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("Overrides = %v, want %v", overrides, want)
+	}
+
+	for _, value := range []string{"server.port", "=9090"} {
+		if err := overrides.Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", value)
+		}
+	}
+
+	cfg, err := LoadConfig(WithConfigDir("../../configs"), WithOverrides(overrides))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("server.port = %d, want 9090", cfg.Server.Port)
+	}
+	if origins := []string{"https://a.example.com", "https://b.example.com"}; !reflect.DeepEqual(cfg.CORS.AllowOrigins, origins) {
+		t.Errorf("cors.allow_origins = %q, want %q", cfg.CORS.AllowOrigins, origins)
+	}
+}
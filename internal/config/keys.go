@@ -0,0 +1,83 @@
+// internal/config/keys.go
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Keys returns every leaf configuration key of Config in dotted form,
+// e.g. "databases.mysql.password".
+func Keys() []string {
+	var keys []string
+	walkKeys(reflect.TypeOf(Config{}), "", func(key string, _ reflect.StructField) {
+		keys = append(keys, key)
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// walkKeys calls fn for every leaf field reachable from t, following
+// mapstructure tags. Durations and other non-struct values are leaves.
+func walkKeys(t reflect.Type, prefix string, fn func(key string, field reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := tagName(field)
+		if name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			walkKeys(field.Type, key, fn)
+			continue
+		}
+		fn(key, field)
+	}
+}
+
+// tagName returns the mapstructure name of a field, defaulting to its
+// lower-cased Go name like mapstructure itself does.
+func tagName(field reflect.StructField) string {
+	tag := field.Tag.Get("mapstructure")
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+// walkValues calls fn with every leaf value reachable from val, keyed like
+// Keys. Values are addressable when val is.
+func walkValues(val reflect.Value, prefix string, fn func(key string, val reflect.Value)) {
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := tagName(field)
+		if name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			walkValues(val.Field(i), key, fn)
+			continue
+		}
+		fn(key, val.Field(i))
+	}
+}
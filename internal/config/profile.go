@@ -0,0 +1,68 @@
+// internal/config/profile.go
+package config
+
+import "strings"
+
+const (
+	// EnvVar selects the active profile, taking precedence over app.env.
+	EnvVar = "GORBIT_ENV"
+	// DefaultEnv is the profile used when none is selected.
+	DefaultEnv = "development"
+)
+
+// profileDefaults are applied for the active profile before any file, env
+// or command-line value, so each profile only has to set what differs.
+var profileDefaults = map[string]map[string]any{
+	"development": {
+		"server.debug":       true,
+		"log.level":          "debug",
+		"log.format":         "text",
+		"cors.allow_origins": []string{"*"},
+	},
+	"test": {
+		"server.debug":       true,
+		"log.level":          "debug",
+		"log.format":         "text",
+		"cors.allow_origins": []string{"*"},
+	},
+	"staging": {
+		"server.debug":       false,
+		"log.level":          "info",
+		"log.format":         "json",
+		"cors.allow_origins": []string{},
+	},
+	"production": {
+		"server.debug":       false,
+		"log.level":          "info",
+		"log.format":         "json",
+		"cors.allow_origins": []string{},
+	},
+}
+
+// defaultsFor returns the defaults of the named profile. Unknown profiles
+// get the production defaults so a typo never enables debug output.
+func defaultsFor(env string) map[string]any {
+	if defaults, ok := profileDefaults[normalizeEnv(env)]; ok {
+		return defaults
+	}
+	return profileDefaults["production"]
+}
+
+func normalizeEnv(env string) string {
+	switch env = strings.ToLower(strings.TrimSpace(env)); env {
+	case "dev", "local":
+		return "development"
+	case "prod":
+		return "production"
+	case "stage":
+		return "staging"
+	default:
+		return env
+	}
+}
+
+// IsDevelopment reports whether the active profile is development or test.
+func (c *Config) IsDevelopment() bool {
+	env := normalizeEnv(c.App.Env)
+	return env == "development" || env == "test"
+}
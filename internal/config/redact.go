@@ -0,0 +1,85 @@
+// internal/config/redact.go
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values when the config is printed.
+const RedactedValue = "******"
+
+// sensitiveNames are key suffixes always treated as secrets, whether or not
+// they were loaded through a secret reference. Connection URIs may embed
+// credentials.
+var sensitiveNames = []string{"password", "secret", "token", "api_key", "uri"}
+
+// IsSensitive reports whether the value of key must not be printed.
+func (c *Config) IsSensitive(key string) bool {
+	if c.secrets[key] {
+		return true
+	}
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, s := range sensitiveNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Settings returns every configuration key with its effective value.
+func (c *Config) Settings() map[string]any {
+	settings := make(map[string]any)
+	walkValues(reflect.ValueOf(c).Elem(), "", func(key string, val reflect.Value) {
+		settings[key] = val.Interface()
+	})
+	return settings
+}
+
+// Redacted returns Settings with sensitive values masked. Empty values are
+// kept so unset secrets remain visible.
+func (c *Config) Redacted() map[string]any {
+	settings := c.Settings()
+	for key, val := range settings {
+		if s, ok := val.(string); ok && s != "" && c.IsSensitive(key) {
+			settings[key] = RedactedValue
+		}
+	}
+	return settings
+}
+
+// String renders the redacted configuration, one sorted key per line.
+func (c *Config) String() string {
+	settings := c.Redacted()
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %v\n", key, settings[key])
+	}
+	return b.String()
+}
+
+// GoString keeps %#v from bypassing redaction.
+func (c *Config) GoString() string {
+	return c.String()
+}
+
+// LogValue logs the redacted configuration.
+func (c *Config) LogValue() slog.Value {
+	settings := c.Redacted()
+	attrs := make([]slog.Attr, 0, len(settings))
+	for key, val := range settings {
+		attrs = append(attrs, slog.Any(key, val))
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,98 @@
+// internal/config/schema.go
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationPattern matches Go duration strings such as "300ms" or "1h30m".
+const durationPattern = `^-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// JSONSchema describes the files in the configuration directory as a JSON
+// Schema (draft-07), derived from Config and its validate tags. Every
+// property is optional since keys may be spread across several files.
+func JSONSchema() map[string]any {
+	schema := objectSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "Gorbit configuration"
+	return schema
+}
+
+func objectSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := tagName(field)
+		if name == "-" {
+			continue
+		}
+		properties[name] = fieldSchema(field)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func fieldSchema(field reflect.StructField) map[string]any {
+	schema := typeSchema(field.Type)
+
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			switch schema["type"] {
+			case "integer", "number":
+				schema[map[string]string{"min": "minimum", "max": "maximum"}[name]] = limit
+			case "string":
+				if field.Type.Kind() == reflect.String {
+					schema[map[string]string{"min": "minLength", "max": "maxLength"}[name]] = int(limit)
+				}
+			}
+		case "oneof":
+			enum := []any{""}
+			for _, v := range strings.Fields(arg) {
+				enum = append(enum, v)
+			}
+			schema["enum"] = enum
+		case "hostname":
+			schema["format"] = "hostname"
+		}
+	}
+	return schema
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return objectSchema(t)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
@@ -0,0 +1,222 @@
+// internal/config/secrets.go
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SecretProvider resolves secret references such as
+// file:///run/secrets/db_pw, env://DB_PW or vault://secret/data/app#key.
+// Providers are selected by the scheme of the reference.
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref *url.URL) (string, error)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface.
+type SecretProviderFunc func(ctx context.Context, ref *url.URL) (string, error)
+
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	return f(ctx, ref)
+}
+
+// WithSecretProvider registers a provider for config values using scheme,
+// replacing the built-in provider of that scheme if any.
+func WithSecretProvider(scheme string, provider SecretProvider) Option {
+	return func(o *options) {
+		if o.providers == nil {
+			o.providers = make(map[string]SecretProvider)
+		}
+		o.providers[strings.ToLower(scheme)] = provider
+	}
+}
+
+// FileSecretProvider reads file://<path> references; a single trailing
+// newline is trimmed.
+var FileSecretProvider = SecretProviderFunc(func(ctx context.Context, ref *url.URL) (string, error) {
+	path := ref.Path
+	if ref.Host != "" {
+		// file://relative/path
+		path = ref.Host + ref.Path
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+})
+
+// EnvSecretProvider reads env://<NAME> references.
+var EnvSecretProvider = SecretProviderFunc(func(ctx context.Context, ref *url.URL) (string, error) {
+	name := ref.Host + ref.Path
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+})
+
+// VaultProvider resolves vault://<path>#<key> references against the HTTP
+// API of HashiCorp Vault or any compatible server. Both KV v1 and KV v2
+// responses are understood; for KV v2 include "data" in the path, e.g.
+// vault://secret/data/myapp#password.
+type VaultProvider struct {
+	Address   string
+	Token     string
+	Namespace string
+	Client    *http.Client
+}
+
+// NewVaultProvider creates a Vault provider. VAULT_ADDR and VAULT_TOKEN are
+// used when address or token are empty.
+func NewVaultProvider(address, token, namespace string, timeout time.Duration) *VaultProvider {
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &VaultProvider{
+		Address:   strings.TrimSuffix(address, "/"),
+		Token:     token,
+		Namespace: namespace,
+		Client:    &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *VaultProvider) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	if p.Address == "" {
+		return "", errors.New("vault address is not configured (secrets.vault.address or VAULT_ADDR)")
+	}
+
+	path := strings.Trim(ref.Host+ref.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Address+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	data := body.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		// KV v2 wraps the secret in data.data
+		data = nested
+	}
+
+	key := ref.Fragment
+	if key == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("vault secret %s has %d keys; select one with #key", path, len(data))
+		}
+		for k := range data {
+			key = k
+		}
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %q", path, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// resolveSecrets replaces every string value that is a reference to one
+// of the registered providers with the resolved secret. The vault settings
+// are resolved first so the Vault token itself may be a file or env
+// reference.
+func resolveSecrets(cfg *Config, extra map[string]SecretProvider) error {
+	providers := map[string]SecretProvider{
+		"file": FileSecretProvider,
+		"env":  EnvSecretProvider,
+	}
+	for scheme, provider := range extra {
+		providers[scheme] = provider
+	}
+
+	ctx := context.Background()
+	cfg.secrets = make(map[string]bool)
+	var errs []error
+
+	resolve := func(prefix string) {
+		walkValues(reflect.ValueOf(cfg).Elem(), "", func(key string, val reflect.Value) {
+			if !strings.HasPrefix(key, prefix) || val.Kind() != reflect.String || cfg.secrets[key] {
+				return
+			}
+			ref, provider := parseSecretRef(val.String(), providers)
+			if provider == nil {
+				return
+			}
+
+			secret, err := provider.Resolve(ctx, ref)
+			if err != nil {
+				errs = append(errs, FieldError{Key: key, Source: cfg.Source(key), Message: err.Error()})
+				return
+			}
+			val.SetString(secret)
+			cfg.secrets[key] = true
+		})
+	}
+
+	resolve("secrets.vault.")
+	if _, ok := providers["vault"]; !ok {
+		vault := cfg.Secrets.Vault
+		providers["vault"] = NewVaultProvider(vault.Address, vault.Token, vault.Namespace, vault.Timeout)
+	}
+	resolve("")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to resolve secrets: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// parseSecretRef returns the provider responsible for value, or nil when
+// value is not a secret reference.
+func parseSecretRef(value string, providers map[string]SecretProvider) (*url.URL, SecretProvider) {
+	scheme, _, ok := strings.Cut(value, "://")
+	if !ok {
+		return nil, nil
+	}
+	provider, ok := providers[strings.ToLower(scheme)]
+	if !ok {
+		return nil, nil
+	}
+	ref, err := url.Parse(value)
+	if err != nil {
+		return nil, nil
+	}
+	return ref, provider
+}
@@ -0,0 +1,138 @@
+// internal/config/secrets_test.go
+package config
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// vaultStub serves the secrets of a KV v1 mount at /v1/kv/ and of a KV v2
+// mount at /v1/secret/data/, and answers 403 to requests without the
+// token or with another namespace.
+func vaultStub(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/myapp":
+			w.Write([]byte(`{"data":{"password":"v1-pass","port":5432}}`))
+		case "/v1/secret/data/myapp":
+			w.Write([]byte(`{"data":{"data":{"password":"v2-pass","user":"app"},"metadata":{"version":3}}}`))
+		case "/v1/secret/data/single":
+			w.Write([]byte(`{"data":{"data":{"token":"only-value"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVaultProviderResolve(t *testing.T) {
+	srv := vaultStub(t)
+	provider := NewVaultProvider(srv.URL, "s.test", "team", time.Second)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "vault://kv/myapp#password", want: "v1-pass"},
+		{ref: "vault://kv/myapp#port", want: "5432"},
+		{ref: "vault://secret/data/myapp#password", want: "v2-pass"},
+		{ref: "vault://secret/data/single", want: "only-value"},
+		{ref: "vault://secret/data/myapp#missing", wantErr: `has no key "missing"`},
+		{ref: "vault://secret/data/myapp", wantErr: "has 2 keys; select one with #key"},
+		{ref: "vault://secret/data/unknown#password", wantErr: "404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			ref, err := url.Parse(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := provider.Resolve(context.Background(), ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultProviderForbidden(t *testing.T) {
+	srv := vaultStub(t)
+	ref, _ := url.Parse("vault://secret/data/myapp#password")
+
+	tests := []struct {
+		name      string
+		token     string
+		namespace string
+	}{
+		{name: "wrong token", token: "s.other", namespace: "team"},
+		{name: "missing namespace", token: "s.test"},
+		{name: "wrong namespace", token: "s.test", namespace: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewVaultProvider(srv.URL, tt.token, tt.namespace, time.Second)
+			_, err := provider.Resolve(context.Background(), ref)
+			if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+				t.Fatalf("Resolve() error = %v, want a 403", err)
+			}
+		})
+	}
+}
+
+func TestVaultSecretsRedacted(t *testing.T) {
+	srv := vaultStub(t)
+	t.Setenv("VAULT_TOKEN", "s.test")
+
+	cfg, err := LoadConfig(
+		WithConfigDir("../../configs"),
+		WithOverrides(map[string]string{
+			"secrets.vault.address":   srv.URL,
+			"secrets.vault.namespace": "team",
+			// Not a sensitive key name: redacted as a resolved secret
+			"app.name": "vault://secret/data/myapp#user",
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.App.Name != "app" {
+		t.Fatalf("app.name = %q, want %q", cfg.App.Name, "app")
+	}
+	if !cfg.IsSensitive("app.name") {
+		t.Error("IsSensitive(app.name) = false, want true")
+	}
+
+	if s := cfg.String(); strings.Contains(s, "app.name: app\n") || !strings.Contains(s, "app.name: "+RedactedValue) {
+		t.Errorf("String() does not redact app.name:\n%s", s)
+	}
+
+	var b strings.Builder
+	slog.New(slog.NewTextHandler(&b, nil)).Info("config", "cfg", cfg)
+	if strings.Contains(b.String(), "cfg.app.name=app") || !strings.Contains(b.String(), "cfg.app.name="+RedactedValue) {
+		t.Errorf("LogValue() does not redact app.name:\n%s", b.String())
+	}
+}
@@ -0,0 +1,287 @@
+// internal/config/store.go
+package config
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// liveKeys can change without a restart; a key is live when it equals or is
+// nested under one of them. Every other change (ports, DSNs, pools, ...) is
+// reported as requiring a restart and not applied.
+var liveKeys = []string{
+	"log.level",
+	"cors",
+	"rate_limit",
+	"features",
+	"app.api_key",
+	"app.jwt_secret",
+}
+
+// reloadDebounce collapses the burst of events editors and Kubernetes
+// ConfigMap updates produce into a single reload.
+const reloadDebounce = 300 * time.Millisecond
+
+// maxReloadHistory bounds the reload results kept for the admin endpoint.
+const maxReloadHistory = 20
+
+// ReloadResult describes the outcome of a configuration reload.
+type ReloadResult struct {
+	Time            time.Time `json:"time"`
+	Success         bool      `json:"success"`
+	Error           string    `json:"error,omitempty"`
+	Applied         []string  `json:"applied"`
+	RestartRequired []string  `json:"restart_required"`
+}
+
+// Store holds the active configuration and swaps it atomically when the
+// configuration directory changes.
+type Store struct {
+	opts    []Option
+	dir     string
+	current atomic.Pointer[Config]
+
+	// reloadMu serializes reloads; mu guards the fields below and is never
+	// held while loading or notifying subscribers
+	reloadMu    sync.Mutex
+	mu          sync.Mutex
+	subscribers []func(cfg *Config)
+	history     []ReloadResult
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// NewStore loads the configuration with opts; the same options are reused
+// on every reload.
+func NewStore(opts ...Option) (*Store, error) {
+	cfg, err := LoadConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{opts: opts, dir: newOptions(opts).dir}
+	s.current.Store(cfg)
+	return s, nil
+}
+
+// Config returns the active configuration. It must not be modified.
+func (s *Store) Config() *Config {
+	return s.current.Load()
+}
+
+// Subscribe registers fn to be called with the new configuration after
+// every reload that applied changes.
+func (s *Store) Subscribe(fn func(cfg *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// History returns the most recent reload results, newest first.
+func (s *Store) History() []ReloadResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := make([]ReloadResult, len(s.history))
+	for i, r := range s.history {
+		history[len(s.history)-1-i] = r
+	}
+	return history
+}
+
+// Reload loads and validates the configuration again. Live keys are
+// applied and subscribers notified; if loading fails the active
+// configuration is kept. Subscribers are called without any lock held, so
+// they may use the store.
+func (s *Store) Reload() ReloadResult {
+	result, notify := s.reload()
+	if notify {
+		s.mu.Lock()
+		subscribers := append([]func(*Config){}, s.subscribers...)
+		s.mu.Unlock()
+
+		// The latest configuration, in case a concurrent reload stored a
+		// newer one since
+		cfg := s.current.Load()
+		for _, fn := range subscribers {
+			fn(cfg)
+		}
+	}
+	return result
+}
+
+// reload applies the live keys of the configuration loaded again and
+// records the result. It reports whether the subscribers are to be
+// notified.
+func (s *Store) reload() (ReloadResult, bool) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	result := ReloadResult{Time: time.Now().UTC(), Applied: []string{}, RestartRequired: []string{}}
+
+	next, err := LoadConfig(s.opts...)
+	if err != nil {
+		result.Error = err.Error()
+		slog.Error("Configuration reload failed, keeping active configuration", "error", err)
+		s.record(result)
+		return result, false
+	}
+
+	current := s.current.Load()
+	applied := *current
+	applied.sources = maps.Clone(current.sources)
+	applied.secrets = maps.Clone(current.secrets)
+
+	nextValues := make(map[string]reflect.Value)
+	walkValues(reflect.ValueOf(next).Elem(), "", func(key string, val reflect.Value) {
+		nextValues[key] = val
+	})
+	walkValues(reflect.ValueOf(&applied).Elem(), "", func(key string, val reflect.Value) {
+		nextVal := nextValues[key]
+		if reflect.DeepEqual(val.Interface(), nextVal.Interface()) {
+			return
+		}
+		if !isLiveKey(key) {
+			result.RestartRequired = append(result.RestartRequired, key)
+			return
+		}
+		val.Set(nextVal)
+		result.Applied = append(result.Applied, key)
+	})
+	sort.Strings(result.Applied)
+	sort.Strings(result.RestartRequired)
+	result.Success = true
+
+	// Keys requiring a restart keep describing their active value
+	for _, key := range result.Applied {
+		applied.sources = replaceEntries(applied.sources, next.sources, key)
+		applied.secrets = replaceEntries(applied.secrets, next.secrets, key)
+	}
+
+	if len(result.Applied) > 0 {
+		s.current.Store(&applied)
+	}
+
+	slog.Info("Configuration reloaded",
+		"applied", result.Applied,
+		"restart_required", result.RestartRequired,
+	)
+	if len(result.RestartRequired) > 0 {
+		slog.Warn("Configuration changes require a restart", "keys", result.RestartRequired)
+	}
+
+	s.record(result)
+	return result, len(result.Applied) > 0
+}
+
+// Watch reloads the configuration whenever a file in the configuration
+// directory changes, until Close is called.
+func (s *Store) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(s.dir); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	s.watcher = watcher
+	s.done = make(chan struct{})
+	go s.watch()
+
+	slog.Debug("Watching configuration directory", "dir", s.dir)
+	return nil
+}
+
+// Close stops watching the configuration directory.
+func (s *Store) Close(ctx context.Context) error {
+	if s.watcher == nil {
+		return nil
+	}
+	err := s.watcher.Close()
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Store) watch() {
+	defer close(s.done)
+
+	var timer *time.Timer
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(reloadDebounce, func() { s.Reload() })
+			} else {
+				timer.Reset(reloadDebounce)
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("Configuration watcher error", "error", err)
+		}
+	}
+}
+
+func (s *Store) record(result ReloadResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, result)
+	if len(s.history) > maxReloadHistory {
+		s.history = s.history[len(s.history)-maxReloadHistory:]
+	}
+}
+
+// replaceEntries replaces the entries of dst for key, and for the keys
+// nested under it, with those of src.
+func replaceEntries[V any](dst, src map[string]V, key string) map[string]V {
+	if dst == nil {
+		dst = make(map[string]V)
+	}
+	for k := range dst {
+		if k == key || strings.HasPrefix(k, key+".") {
+			delete(dst, k)
+		}
+	}
+	for k, v := range src {
+		if k == key || strings.HasPrefix(k, key+".") {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+func isLiveKey(key string) bool {
+	for _, live := range liveKeys {
+		if key == live || strings.HasPrefix(key, live+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+// internal/config/store_test.go
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyConfigs copies the shipped configuration files into a temporary
+// directory the test may edit.
+func copyConfigs(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	paths, err := filepath.Glob("../../configs/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(path)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// setRateLimitMax rewrites rate_limit.max in the config.yaml of dir.
+func setRateLimitMax(t *testing.T, dir, max string) {
+	t.Helper()
+	path := filepath.Join(dir, "config.yaml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "  max: ") {
+			lines[i] = "  max: " + max
+		}
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	dir := copyConfigs(t)
+	s, err := NewStore(WithConfigDir(dir), WithEnv("development"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := s.Config()
+
+	var notified []*Config
+	s.Subscribe(func(cfg *Config) { notified = append(notified, cfg) })
+
+	// A live key and two keys requiring a restart, each from a secret
+	// reference or another source than before
+	t.Setenv("TEST_LOG_LEVEL", "warn")
+	t.Setenv("TEST_APP_NAME", "renamed")
+	t.Setenv("GORBIT_LOG_LEVEL", "env://TEST_LOG_LEVEL")
+	t.Setenv("GORBIT_APP_NAME", "env://TEST_APP_NAME")
+	t.Setenv("GORBIT_SERVER_PORT", "9999")
+	setRateLimitMax(t, dir, "250")
+
+	result := s.Reload()
+	if !result.Success {
+		t.Fatalf("Reload() failed: %s", result.Error)
+	}
+	if want := []string{"log.level", "rate_limit.max"}; !reflect.DeepEqual(result.Applied, want) {
+		t.Errorf("Applied = %v, want %v", result.Applied, want)
+	}
+	if want := []string{"app.name", "server.port"}; !reflect.DeepEqual(result.RestartRequired, want) {
+		t.Errorf("RestartRequired = %v, want %v", result.RestartRequired, want)
+	}
+
+	cfg := s.Config()
+	if cfg.Log.Level != "warn" || cfg.RateLimit.Max != 250 {
+		t.Errorf("live keys = %q, %d; want warn, 250", cfg.Log.Level, cfg.RateLimit.Max)
+	}
+	if cfg.App.Name != initial.App.Name || cfg.Server.Port != initial.Server.Port {
+		t.Errorf("restart-required keys = %q, %d; want %q, %d", cfg.App.Name, cfg.Server.Port, initial.App.Name, initial.Server.Port)
+	}
+	if initial.Log.Level == "warn" || initial.Source("log.level") != "profile default (development)" {
+		t.Errorf("the reload modified the previous configuration")
+	}
+
+	for key, want := range map[string]string{
+		"log.level":   "env GORBIT_LOG_LEVEL",
+		"app.name":    filepath.Join(dir, "config.yaml"),
+		"server.port": filepath.Join(dir, "config.yaml"),
+	} {
+		if got := cfg.Source(key); got != want {
+			t.Errorf("Source(%s) = %q, want %q", key, got, want)
+		}
+	}
+	if !cfg.IsSensitive("log.level") {
+		t.Error("IsSensitive(log.level) = false, want true for an applied secret")
+	}
+	if cfg.IsSensitive("app.name") {
+		t.Error("IsSensitive(app.name) = true, but its secret is not applied")
+	}
+
+	if len(notified) != 1 || notified[0] != cfg {
+		t.Errorf("subscribers notified %d times, want once with the new configuration", len(notified))
+	}
+
+	// Nothing live changed since: the subscribers are not notified again
+	result = s.Reload()
+	if len(result.Applied) != 0 || len(result.RestartRequired) != 2 || len(notified) != 1 {
+		t.Errorf("second Reload() = %+v, notified %d times", result, len(notified))
+	}
+
+	t.Setenv("GORBIT_SERVER_PORT", "not-a-port")
+	result = s.Reload()
+	if result.Success || result.Error == "" || s.Config() != cfg {
+		t.Errorf("invalid Reload() = %+v, want a failure keeping the configuration", result)
+	}
+
+	history := s.History()
+	if len(history) != 3 || history[0].Success || !history[2].Success || len(history[2].Applied) != 2 {
+		t.Errorf("History() = %+v, want the three results newest first", history)
+	}
+}
+
+func TestStoreHistoryTrimmed(t *testing.T) {
+	s, err := NewStore(WithConfigDir("../../configs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxReloadHistory+5; i++ {
+		s.Reload()
+	}
+	history := s.History()
+	if len(history) != maxReloadHistory {
+		t.Fatalf("len(History()) = %d, want %d", len(history), maxReloadHistory)
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Time.After(history[i-1].Time) {
+			t.Fatalf("History() is not newest first at %d", i)
+		}
+	}
+}
+
+func TestStoreWatchDebounce(t *testing.T) {
+	dir := copyConfigs(t)
+	s, err := NewStore(WithConfigDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan *Config, 10)
+	s.Subscribe(func(cfg *Config) { reloaded <- cfg })
+	if err := s.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close(context.Background()) })
+
+	// A burst of writes closer together than the debounce
+	for _, max := range []string{"101", "102", "103", "104"} {
+		setRateLimitMax(t, dir, max)
+		time.Sleep(reloadDebounce / 10)
+	}
+
+	select {
+	case cfg := <-reloaded:
+		if cfg.RateLimit.Max != 104 {
+			t.Errorf("rate_limit.max = %d, want the last written 104", cfg.RateLimit.Max)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the configuration changed")
+	}
+	time.Sleep(2 * reloadDebounce)
+	if n := len(s.History()); n != 1 {
+		t.Errorf("%d reloads, want the burst collapsed into one", n)
+	}
+}
@@ -0,0 +1,185 @@
+// internal/config/validate.go
+package config
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validation rules are declared with `validate` struct tags, comma separated:
+//
+//	required       the value must be set (non-zero)
+//	min=N, max=N   numeric bounds; string length for strings
+//	hostname       an RFC 1123 hostname or an IP address
+//	oneof=a b c    one of the listed values (an empty value is allowed)
+//	noplaceholder  outside development, rejects sample values such as
+//	               "your-256-bit-secret"
+//
+// Sections with an `enabled` key are only validated when enabled.
+
+// FieldError describes one invalid configuration key.
+type FieldError struct {
+	Key     string
+	Source  string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.Key, e.Source, e.Message)
+}
+
+// ValidationError aggregates every invalid key found by Validate.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, f := range e.Fields {
+		b.WriteString("\n  - ")
+		b.WriteString(f.Error())
+	}
+	return b.String()
+}
+
+var (
+	hostnamePattern    = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+	placeholderPattern = regexp.MustCompile(`(?i)^(your[-_ ].*|.*change[-_ ]?me.*|placeholder|secret|password|todo|xxx+)$`)
+)
+
+// Validate checks cfg against the rules declared on Config and returns a
+// *ValidationError listing every invalid key, or nil.
+func Validate(cfg *Config) error {
+	v := &validator{cfg: cfg, development: cfg.IsDevelopment()}
+	v.walk(reflect.ValueOf(cfg).Elem(), "")
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.errs}
+}
+
+type validator struct {
+	cfg         *Config
+	development bool
+	errs        []FieldError
+}
+
+func (v *validator) walk(val reflect.Value, prefix string) {
+	t := val.Type()
+
+	// Skip disabled sections entirely
+	if enabled := val.FieldByName("Enabled"); enabled.IsValid() && enabled.Kind() == reflect.Bool && !enabled.Bool() {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := tagName(field)
+		if name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		fv := val.Field(i)
+		if fv.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			v.walk(fv, key)
+			continue
+		}
+
+		if rules := field.Tag.Get("validate"); rules != "" {
+			v.check(key, fv, rules)
+		}
+	}
+}
+
+func (v *validator) check(key string, val reflect.Value, rules string) {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if msg := v.apply(name, arg, val); msg != "" {
+			v.errs = append(v.errs, FieldError{Key: key, Source: v.cfg.Source(key), Message: msg})
+			// One message per key is enough to fix it
+			return
+		}
+	}
+}
+
+func (v *validator) apply(rule, arg string, val reflect.Value) string {
+	switch rule {
+	case "required":
+		if val.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		if val.IsZero() && rule == "min" && arg != "0" {
+			// Covered by required when the key is mandatory
+			return ""
+		}
+		return checkBound(rule, arg, val)
+	case "hostname":
+		s := val.String()
+		if s != "" && net.ParseIP(s) == nil && !hostnamePattern.MatchString(s) {
+			return fmt.Sprintf("%q is not a valid hostname or IP address", s)
+		}
+	case "oneof":
+		s := val.String()
+		if s == "" {
+			return ""
+		}
+		for _, allowed := range strings.Fields(arg) {
+			if s == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q must be one of: %s", s, strings.Join(strings.Fields(arg), ", "))
+	case "noplaceholder":
+		if !v.development && placeholderPattern.MatchString(val.String()) {
+			return fmt.Sprintf("placeholder value is not allowed in %q environment", v.cfg.App.Env)
+		}
+	default:
+		return fmt.Sprintf("unknown validation rule %q", rule)
+	}
+	return ""
+}
+
+func checkBound(rule, arg string, val reflect.Value) string {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return fmt.Sprintf("invalid %s bound %q", rule, arg)
+	}
+
+	var n float64
+	what := "must be"
+	switch val.Kind() {
+	case reflect.String:
+		n = float64(len(val.String()))
+		what = "length must be"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = val.Float()
+	default:
+		return ""
+	}
+
+	if rule == "min" && n < limit {
+		return fmt.Sprintf("%s at least %s", what, arg)
+	}
+	if rule == "max" && n > limit {
+		return fmt.Sprintf("%s at most %s", what, arg)
+	}
+	return ""
+}
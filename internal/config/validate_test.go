@@ -0,0 +1,205 @@
+// internal/config/validate_test.go
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type validateSample struct {
+	Name    string        `mapstructure:"name" validate:"required,min=3,max=8"`
+	Port    int           `mapstructure:"port" validate:"required,min=1,max=65535"`
+	Workers int           `mapstructure:"workers" validate:"min=2"`
+	Ratio   float64       `mapstructure:"ratio" validate:"min=0,max=1"`
+	Retries uint          `mapstructure:"retries" validate:"max=10"`
+	Host    string        `mapstructure:"host" validate:"hostname"`
+	Mode    string        `mapstructure:"mode" validate:"oneof=fast safe"`
+	Secret  string        `mapstructure:"secret" validate:"noplaceholder"`
+	Timeout time.Duration `mapstructure:"timeout" validate:"min=0"`
+	Labels  []string      `mapstructure:"labels" validate:"max=1"`
+	Nested  struct {
+		Level  int `mapstructure:"level" validate:"max=5"`
+		Deeper struct {
+			Name string `mapstructure:"name" validate:"required"`
+		} `mapstructure:"deeper"`
+	} `mapstructure:"nested"`
+	Optional struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Host    string `mapstructure:"host" validate:"required,hostname"`
+	} `mapstructure:"optional"`
+}
+
+func validSample() validateSample {
+	var s validateSample
+	s.Name = "gorbit"
+	s.Port = 8080
+	s.Host = "db.internal"
+	s.Nested.Deeper.Name = "x"
+	return s
+}
+
+// validateValue runs the rules of the struct v points to, as Validate does
+// for Config.
+func validateValue(v any, development bool) []FieldError {
+	val := &validator{cfg: &Config{}, development: development}
+	val.cfg.App.Env = "production"
+	val.walk(reflect.ValueOf(v).Elem(), "")
+	return val.errs
+}
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		set         func(s *validateSample)
+		development bool
+		want        map[string]string
+	}{
+		{name: "valid", set: func(s *validateSample) {}},
+		{
+			name: "required",
+			set:  func(s *validateSample) { s.Name, s.Port = "", 0 },
+			want: map[string]string{"name": "is required", "port": "is required"},
+		},
+		{
+			name: "string length",
+			set:  func(s *validateSample) { s.Name = "ab" },
+			want: map[string]string{"name": "length must be at least 3"},
+		},
+		{
+			name: "string too long",
+			set:  func(s *validateSample) { s.Name = "much-too-long" },
+			want: map[string]string{"name": "length must be at most 8"},
+		},
+		{
+			name: "numeric bounds",
+			set: func(s *validateSample) {
+				s.Port, s.Workers, s.Ratio, s.Retries, s.Timeout = 70000, 1, 1.5, 11, -time.Second
+			},
+			want: map[string]string{
+				"port":    "must be at most 65535",
+				"workers": "must be at least 2",
+				"ratio":   "must be at most 1",
+				"retries": "must be at most 10",
+				"timeout": "must be at least 0",
+			},
+		},
+		{
+			// An unset optional key is left to required
+			name: "zero value below min",
+			set:  func(s *validateSample) { s.Workers = 0 },
+		},
+		{
+			name: "hostnames",
+			set:  func(s *validateSample) { s.Host = "bad_host!" },
+			want: map[string]string{"host": `"bad_host!" is not a valid hostname or IP address`},
+		},
+		{
+			name: "ip address",
+			set:  func(s *validateSample) { s.Host = "::1" },
+		},
+		{
+			name: "oneof",
+			set:  func(s *validateSample) { s.Mode = "turbo" },
+			want: map[string]string{"mode": `"turbo" must be one of: fast, safe`},
+		},
+		{
+			name: "oneof allows empty",
+			set:  func(s *validateSample) { s.Mode = "" },
+		},
+		{
+			name: "placeholder",
+			set:  func(s *validateSample) { s.Secret = "your-api-key-here" },
+			want: map[string]string{"secret": `placeholder value is not allowed in "production" environment`},
+		},
+		{
+			name:        "placeholder in development",
+			set:         func(s *validateSample) { s.Secret = "changeme" },
+			development: true,
+		},
+		{
+			name: "unsupported kinds are not bounded",
+			set:  func(s *validateSample) { s.Labels = []string{"a", "b"} },
+		},
+		{
+			name: "nested structs",
+			set:  func(s *validateSample) { s.Nested.Level = 6; s.Nested.Deeper.Name = "" },
+			want: map[string]string{"nested.level": "must be at most 5", "nested.deeper.name": "is required"},
+		},
+		{
+			name: "enabled section",
+			set:  func(s *validateSample) { s.Optional.Enabled = true; s.Optional.Host = "" },
+			want: map[string]string{"optional.host": "is required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSample()
+			tt.set(&s)
+
+			got := make(map[string]string)
+			for _, e := range validateValue(&s, tt.development) {
+				if _, dup := got[e.Key]; dup {
+					t.Errorf("several errors for %s", e.Key)
+				}
+				got[e.Key] = e.Message
+			}
+			if len(got) != 0 || len(tt.want) != 0 {
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("errors = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateInvalidRules(t *testing.T) {
+	var s struct {
+		Email string `mapstructure:"email" validate:"required,email"`
+		Size  int    `mapstructure:"size" validate:"max=ten"`
+	}
+	s.Email, s.Size = "a@example.com", 1
+
+	errs := validateValue(&s, false)
+	want := []FieldError{
+		{Key: "email", Source: "not set", Message: `unknown validation rule "email"`},
+		{Key: "size", Source: "not set", Message: `invalid max bound "ten"`},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("errors = %+v, want %+v", errs, want)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg, err := LoadConfig(WithConfigDir("../../configs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("Validate() of the shipped configuration = %v", err)
+	}
+
+	cfg.Server.Port = 0
+	cfg.Log.Level = "verbose"
+	// Disabled sections are not validated
+	cfg.Databases.MySQL.Enabled = false
+	cfg.Databases.MySQL.Host = ""
+
+	err = Validate(cfg)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 2 {
+		t.Fatalf("Validate() = %v, want two invalid keys", err)
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		"invalid configuration:",
+		"\n  - server.port (../../configs/config.yaml): is required",
+		`log.level (profile default (development)): "verbose" must be one of: debug, info, warn, error`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Validate() = %q, want it to contain %q", msg, want)
+		}
+	}
+}
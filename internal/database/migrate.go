@@ -0,0 +1,660 @@
+// internal/database/migrate.go
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultMigrationsDir holds one directory of migrations per datastore,
+	// e.g. migrations/postgres.
+	DefaultMigrationsDir = "migrations"
+	// MigrationsTable records the applied SQL migrations.
+	MigrationsTable = "schema_migrations"
+)
+
+// Migration is a versioned schema change read from
+// <version>_<name>.up.sql and the optional <version>_<name>.down.sql.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads the migrations in dir, ordered by version. A missing
+// directory has no migrations.
+func LoadMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+			sum := sha256.Sum256(data)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// CreateMigration writes an empty up/down pair for name into dir, versioned
+// with the current UTC time, and returns the file paths.
+func CreateMigration(dir, name string) (up, down string, err error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name is empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+
+	base := filepath.Join(dir, time.Now().UTC().Format("20060102150405")+"_"+name)
+	up, down = base+".up.sql", base+".down.sql"
+	for _, f := range []struct{ path, direction string }{{up, "up"}, {down, "down"}} {
+		content := fmt.Sprintf("-- %s (%s)\n", name, f.direction)
+		if err := os.WriteFile(f.path, []byte(content), 0o644); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
+
+func createSQLMigration(dir, name string) ([]string, error) {
+	up, down, err := CreateMigration(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return []string{up, down}, nil
+}
+
+// MigrationStatus describes a migration file, its applied record, or both.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Dirty is set when the migration failed part way
+	Dirty bool
+	// Modified is set when the up file changed after it was applied
+	Modified bool
+	// Missing is set when an applied migration has no file any more
+	Missing bool
+}
+
+// PlannedStep is a change a migration would make, reported by dry runs.
+type PlannedStep struct {
+	Version int64
+	Name    string
+	Change  string
+}
+
+// SchemaMigrator applies the versioned migrations of one datastore.
+type SchemaMigrator interface {
+	// Status lists every migration, applied or pending, ordered by version.
+	Status(ctx context.Context) ([]MigrationStatus, error)
+	// Up applies up to limit pending migrations, all of them if limit is 0.
+	Up(ctx context.Context, limit int) ([]MigrationStatus, error)
+	// Down reverts up to limit applied migrations, one if limit is 0.
+	Down(ctx context.Context, limit int) ([]MigrationStatus, error)
+	// Redo reverts and re-applies the newest applied migration.
+	Redo(ctx context.Context) (MigrationStatus, error)
+	// Force records version as the newest applied migration.
+	Force(ctx context.Context, version int64) error
+	// Plan reports what Up or Down would change without applying it.
+	Plan(ctx context.Context, limit int, down bool) ([]PlannedStep, error)
+}
+
+// Migratable is implemented by stores with versioned migrations.
+type Migratable interface {
+	// Migrator returns a SchemaMigrator for the migrations in dir.
+	Migrator(dir string) (SchemaMigrator, error)
+}
+
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// Migrator applies SQL migrations to a MySQL or PostgreSQL database. Every
+// operation holds a database-wide advisory lock, so instances starting at
+// the same time apply each migration once.
+type Migrator struct {
+	db         *gorm.DB
+	dialect    string
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for db, which must be a MySQL or
+// PostgreSQL connection.
+func NewMigrator(db *gorm.DB, migrations []Migration) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+	if dialect != "mysql" && dialect != "postgres" {
+		return nil, fmt.Errorf("migrations are not supported for %s", dialect)
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Status lists every migration, applied or pending, ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var list []MigrationStatus
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[int64]bool)
+		for _, mig := range m.migrations {
+			seen[mig.Version] = true
+			s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if rec, ok := applied[mig.Version]; ok {
+				s.Applied, s.AppliedAt, s.Dirty = true, rec.AppliedAt, rec.Dirty
+				s.Modified = rec.Checksum != mig.Checksum
+			}
+			list = append(list, s)
+		}
+		for _, rec := range applied {
+			if !seen[rec.Version] {
+				list = append(list, MigrationStatus{
+					Version: rec.Version, Name: rec.Name, Applied: true,
+					AppliedAt: rec.AppliedAt, Dirty: rec.Dirty, Missing: true,
+				})
+			}
+		}
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, err
+}
+
+// Up applies up to limit pending migrations in version order; a limit of 0
+// applies all of them. It refuses to run while a migration is dirty or an
+// applied migration was modified.
+func (m *Migrator) Up(ctx context.Context, limit int) ([]MigrationStatus, error) {
+	return m.run(ctx, limit, false)
+}
+
+// Down reverts up to limit applied migrations, newest first; a limit of 0
+// reverts one.
+func (m *Migrator) Down(ctx context.Context, limit int) ([]MigrationStatus, error) {
+	return m.run(ctx, max(limit, 1), true)
+}
+
+func (m *Migrator) run(ctx context.Context, limit int, down bool) ([]MigrationStatus, error) {
+	var done []MigrationStatus
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, i := range selectMigrations(m.versions(), isApplied(applied), limit, down) {
+			mig := m.migrations[i]
+			if err := m.apply(conn, mig, !down); err != nil {
+				return err
+			}
+			done = append(done, MigrationStatus{
+				Version: mig.Version, Name: mig.Name, Applied: !down, AppliedAt: time.Now(),
+			})
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Redo reverts and re-applies the newest applied migration.
+func (m *Migrator) Redo(ctx context.Context) (MigrationStatus, error) {
+	var redone MigrationStatus
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		last := selectMigrations(m.versions(), isApplied(applied), 1, true)
+		if len(last) == 0 {
+			return errors.New("no applied migration to redo")
+		}
+		mig := m.migrations[last[0]]
+		if err := m.apply(conn, mig, false); err != nil {
+			return err
+		}
+		if err := m.apply(conn, mig, true); err != nil {
+			return err
+		}
+		redone = MigrationStatus{Version: mig.Version, Name: mig.Name, Applied: true, AppliedAt: time.Now()}
+		return nil
+	})
+	return redone, err
+}
+
+// Plan lists the statements Up (or Down if down is set) would run with the
+// same limit, without changing the database.
+func (m *Migrator) Plan(ctx context.Context, limit int, down bool) ([]PlannedStep, error) {
+	if down {
+		limit = max(limit, 1)
+	}
+	var steps []PlannedStep
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, i := range selectMigrations(m.versions(), isApplied(applied), limit, down) {
+			mig := m.migrations[i]
+			script := mig.Up
+			if down {
+				script = mig.Down
+			}
+			stmts := splitStatements(script, m.dialect == "mysql")
+			if len(stmts) == 0 {
+				stmts = []string{"(no statements)"}
+			}
+			for _, stmt := range stmts {
+				steps = append(steps, PlannedStep{Version: mig.Version, Name: mig.Name, Change: stmt})
+			}
+		}
+		return nil
+	})
+	return steps, err
+}
+
+func (m *Migrator) versions() []int64 {
+	versions := make([]int64, len(m.migrations))
+	for i, mig := range m.migrations {
+		versions[i] = mig.Version
+	}
+	return versions
+}
+
+func isApplied(applied map[int64]appliedMigration) func(version int64) bool {
+	return func(version int64) bool {
+		_, ok := applied[version]
+		return ok
+	}
+}
+
+// selectMigrations returns the indexes into the ascending versions of up to
+// limit migrations to run: pending ones in order, or with down set, applied
+// ones newest first. A limit of 0 selects all of them.
+func selectMigrations(versions []int64, applied func(version int64) bool, limit int, down bool) []int {
+	var selected []int
+	for n := range versions {
+		i := n
+		if down {
+			i = len(versions) - 1 - n
+		}
+		if applied(versions[i]) != down {
+			continue
+		}
+		if limit > 0 && len(selected) == limit {
+			break
+		}
+		selected = append(selected, i)
+	}
+	return selected
+}
+
+// Force records version as the newest applied migration without running
+// any SQL: it and every earlier migration are marked applied and clean, and
+// the records of later versions are removed. Version 0 removes every
+// record. It is meant to recover from a dirty migration after fixing the
+// schema by hand.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	found := version == 0
+	for _, mig := range m.migrations {
+		found = found || mig.Version == version
+	}
+	if !found {
+		return fmt.Errorf("no migration file for version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM "+MigrationsTable+" WHERE version > ?", version).Error; err != nil {
+				return err
+			}
+			for _, mig := range m.migrations {
+				if mig.Version > version {
+					break
+				}
+				if _, ok := applied[mig.Version]; ok {
+					err = tx.Exec("UPDATE "+MigrationsTable+" SET checksum = ?, dirty = ? WHERE version = ?",
+						mig.Checksum, false, mig.Version).Error
+				} else {
+					err = tx.Exec("INSERT INTO "+MigrationsTable+" (version, name, checksum, dirty) VALUES (?, ?, ?, ?)",
+						mig.Version, mig.Name, mig.Checksum, false).Error
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// withLock runs fn on a single connection holding the migration lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// A new session keeps a failed statement from poisoning the next one
+		conn = conn.Session(&gorm.Session{})
+		if err := m.lock(ctx, conn); err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.unlock(conn); err != nil {
+				slog.Warn("Failed to release migration lock", "store", m.dialect, "error", err)
+			}
+		}()
+
+		err := conn.Exec(`CREATE TABLE IF NOT EXISTS ` + MigrationsTable + ` (
+			version BIGINT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			dirty BOOLEAN NOT NULL DEFAULT FALSE,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`).Error
+		if err != nil {
+			return fmt.Errorf("create %s: %w", MigrationsTable, err)
+		}
+		return fn(conn)
+	})
+}
+
+// lockKey identifies the migration lock; both locks are scoped to the
+// current database.
+func lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("gorbit:" + MigrationsTable))
+	return int64(h.Sum64())
+}
+
+func (m *Migrator) lock(ctx context.Context, conn *gorm.DB) error {
+	if m.dialect == "postgres" {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey()).Error; err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		return nil
+	}
+
+	// GET_LOCK waits for the given number of seconds, or forever if negative
+	timeout := -1
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = max(int(time.Until(deadline).Seconds()), 0)
+	}
+	var got *int
+	err := conn.Raw("SELECT GET_LOCK(CONCAT(DATABASE(), ?), ?)", ":"+MigrationsTable, timeout).Row().Scan(&got)
+	if err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	if got == nil || *got != 1 {
+		return errors.New("acquire migration lock: timed out")
+	}
+	return nil
+}
+
+func (m *Migrator) unlock(conn *gorm.DB) error {
+	// The lock is released even if the migration context was canceled
+	conn = conn.WithContext(context.Background())
+	if m.dialect == "postgres" {
+		return conn.Exec("SELECT pg_advisory_unlock(?)", lockKey()).Error
+	}
+	return conn.Exec("SELECT RELEASE_LOCK(CONCAT(DATABASE(), ?))", ":"+MigrationsTable).Error
+}
+
+func (m *Migrator) applied(conn *gorm.DB) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	err := conn.Raw("SELECT version, name, checksum, dirty, applied_at FROM " + MigrationsTable).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", MigrationsTable, err)
+	}
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// verify refuses to migrate a dirty database or one whose applied
+// migrations no longer match their files.
+func (m *Migrator) verify(applied map[int64]appliedMigration) error {
+	for _, rec := range applied {
+		if rec.Dirty {
+			return fmt.Errorf("migration %d_%s is dirty: fix the schema, then run `gorbit migrate force` with the last good version", rec.Version, rec.Name)
+		}
+	}
+	for _, mig := range m.migrations {
+		if rec, ok := applied[mig.Version]; ok && rec.Checksum != mig.Checksum {
+			return fmt.Errorf("migration %d_%s was modified after it was applied", mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// apply runs one migration and updates its record. The record is marked
+// dirty while the statements run; on PostgreSQL everything runs in one
+// transaction, MySQL commits DDL implicitly so a failure leaves the
+// migration dirty.
+func (m *Migrator) apply(conn *gorm.DB, mig Migration, up bool) error {
+	script, direction := mig.Up, "up"
+	if !up {
+		script, direction = mig.Down, "down"
+		if strings.TrimSpace(mig.Down) == "" {
+			return fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+	}
+
+	run := func(tx *gorm.DB) error {
+		var err error
+		if up {
+			err = tx.Exec("INSERT INTO "+MigrationsTable+" (version, name, checksum, dirty) VALUES (?, ?, ?, ?)",
+				mig.Version, mig.Name, mig.Checksum, true).Error
+		} else {
+			err = tx.Exec("UPDATE "+MigrationsTable+" SET dirty = ? WHERE version = ?", true, mig.Version).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, stmt := range splitStatements(script, m.dialect == "mysql") {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		if up {
+			return tx.Exec("UPDATE "+MigrationsTable+" SET dirty = ? WHERE version = ?", false, mig.Version).Error
+		}
+		return tx.Exec("DELETE FROM "+MigrationsTable+" WHERE version = ?", mig.Version).Error
+	}
+
+	start := time.Now()
+	var err error
+	if m.dialect == "postgres" {
+		err = conn.Transaction(run)
+	} else {
+		err = run(conn)
+	}
+	if err != nil {
+		return fmt.Errorf("migration %d_%s %s failed: %w", mig.Version, mig.Name, direction, err)
+	}
+
+	slog.Info("Applied migration",
+		"store", m.dialect,
+		"version", mig.Version,
+		"name", mig.Name,
+		"direction", direction,
+		"duration", time.Since(start),
+	)
+	return nil
+}
+
+// splitStatements splits a SQL script on semicolons outside of quotes,
+// comments and PostgreSQL dollar-quoted bodies, dropping statements that
+// only hold comments. backslash enables MySQL backslash escapes in strings.
+func splitStatements(script string, backslash bool) []string {
+	var stmts []string
+	start, code := 0, false
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case strings.HasPrefix(script[i:], "--"):
+			if j := strings.IndexByte(script[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(script)
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			if j := strings.Index(script[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(script)
+			}
+		case c == '\'' || c == '"' || c == '`':
+			code = true
+			i = closingQuote(script, i, backslash)
+		case c == '$' && dollarTag(script[i:]) != "":
+			code = true
+			tag := dollarTag(script[i:])
+			if j := strings.Index(script[i+len(tag):], tag); j >= 0 {
+				i += len(tag) + j + len(tag) - 1
+			} else {
+				i = len(script)
+			}
+		case c == ';':
+			if code {
+				stmts = append(stmts, strings.TrimSpace(script[start:i]))
+			}
+			start, code = i+1, false
+		case !unicode.IsSpace(rune(c)):
+			code = true
+		}
+	}
+	if code {
+		stmts = append(stmts, strings.TrimSpace(script[start:]))
+	}
+	return stmts
+}
+
+// closingQuote returns the index of the quote closing the one at start.
+func closingQuote(script string, start int, backslash bool) int {
+	q := script[start]
+	for i := start + 1; i < len(script); i++ {
+		switch {
+		case backslash && script[i] == '\\':
+			i++
+		case script[i] == q && i+1 < len(script) && script[i+1] == q:
+			i++
+		case script[i] == q:
+			return i
+		}
+	}
+	return len(script)
+}
+
+var dollarTagPattern = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+func dollarTag(s string) string {
+	return dollarTagPattern.FindString(s)
+}
+
+// Migrate applies the pending migrations of every opened store that has
+// them, from dir/<store>, e.g. migrations/postgres.
+func (r *Registry) Migrate(ctx context.Context, dir string) error {
+	if dir == "" {
+		dir = DefaultMigrationsDir
+	}
+	for _, s := range r.stores {
+		store, ok := s.Store.(Migratable)
+		if !ok {
+			continue
+		}
+		m, err := store.Migrator(filepath.Join(dir, s.Name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		applied, err := m.Up(ctx, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		slog.Info("Migrations up to date", "store", s.Name, "applied", len(applied))
+	}
+	return nil
+}
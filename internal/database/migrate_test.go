@@ -0,0 +1,105 @@
+// internal/database/migrate_test.go
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name      string
+		script    string
+		backslash bool
+		want      []string
+	}{
+		{
+			name:   "single without semicolon",
+			script: "CREATE TABLE t (id INT)",
+			want:   []string{"CREATE TABLE t (id INT)"},
+		},
+		{
+			name:   "several",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "empty statements",
+			script: ";; \n ;",
+			want:   nil,
+		},
+		{
+			name:   "semicolon in string",
+			script: "INSERT INTO t VALUES ('a;b'); SELECT 1",
+			want:   []string{"INSERT INTO t VALUES ('a;b')", "SELECT 1"},
+		},
+		{
+			name:   "doubled quote",
+			script: "INSERT INTO t VALUES ('it''s; fine'); SELECT 2",
+			want:   []string{"INSERT INTO t VALUES ('it''s; fine')", "SELECT 2"},
+		},
+		{
+			name:   "quoted identifiers",
+			script: "SELECT \"a;b\" FROM `c;d`; SELECT 3",
+			want:   []string{"SELECT \"a;b\" FROM `c;d`", "SELECT 3"},
+		},
+		{
+			name:      "backslash escape on mysql",
+			script:    `INSERT INTO t VALUES ('a\';b'); SELECT 4`,
+			backslash: true,
+			want:      []string{`INSERT INTO t VALUES ('a\';b')`, "SELECT 4"},
+		},
+		{
+			name:   "backslash is literal on postgres",
+			script: `INSERT INTO t VALUES ('a\'); SELECT 5`,
+			want:   []string{`INSERT INTO t VALUES ('a\')`, "SELECT 5"},
+		},
+		{
+			name:   "line comment",
+			script: "-- create; the table\nCREATE TABLE t (id INT); -- trailing; comment",
+			want:   []string{"-- create; the table\nCREATE TABLE t (id INT)"},
+		},
+		{
+			name:   "block comment",
+			script: "/* one; two */ SELECT 1; /* only a comment; */",
+			want:   []string{"/* one; two */ SELECT 1"},
+		},
+		{
+			name:   "unterminated comment",
+			script: "SELECT 1; /* never closed; SELECT 2",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name: "dollar quoted function",
+			script: `CREATE FUNCTION f() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at = now();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER t BEFORE UPDATE ON x FOR EACH ROW EXECUTE FUNCTION f();`,
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.updated_at = now();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql",
+				"CREATE TRIGGER t BEFORE UPDATE ON x FOR EACH ROW EXECUTE FUNCTION f()",
+			},
+		},
+		{
+			name:   "tagged dollar quote",
+			script: "DO $body$ BEGIN PERFORM 'x;y'; END $body$; SELECT 6",
+			want:   []string{"DO $body$ BEGIN PERFORM 'x;y'; END $body$", "SELECT 6"},
+		},
+		{
+			name:   "positional parameters are not dollar quotes",
+			script: "PREPARE p AS SELECT $1; SELECT 7",
+			want:   []string{"PREPARE p AS SELECT $1", "SELECT 7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script, tt.backslash)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,733 @@
+// internal/database/mongo_migrate.go
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MongoMigrationsCollection records the applied MongoDB migrations.
+	MongoMigrationsCollection = "_gorbit_migrations"
+
+	// mongoLockID is the _id of the lock document in the migrations
+	// collection; applied migrations use their version as _id.
+	mongoLockID = "lock"
+	// mongoLockTTL is how long a lock outlives its last refresh before
+	// another run may take it over, in case the process holding it died.
+	mongoLockTTL = time.Minute
+	// mongoLockRefresh is how often the holder extends its lock.
+	mongoLockRefresh = mongoLockTTL / 4
+	// DefaultMongoBatchSize is the batch size of MongoUpdateMany.
+	DefaultMongoBatchSize = 1000
+)
+
+// MongoOp is one step of a MongoDB migration.
+type MongoOp interface {
+	// Apply makes the change.
+	Apply(ctx context.Context, db *mongo.Database) error
+	// Describe reports what Apply would change without changing anything.
+	Describe(ctx context.Context, db *mongo.Database) (string, error)
+}
+
+// MongoMigration is a versioned MongoDB change, registered from Go with
+// RegisterMongoMigration or read from <version>_<name>.json.
+type MongoMigration struct {
+	Version int64
+	Name    string
+	Up      []MongoOp
+	Down    []MongoOp
+	// Checksum is set for file migrations; Go migrations are not checked
+	Checksum string
+}
+
+var (
+	mongoMigrationsMu sync.Mutex
+	mongoMigrations   []MongoMigration
+)
+
+// RegisterMongoMigration adds a Go-defined migration, typically from the
+// init function of a package imported by both the service and the CLI. It
+// panics if the migration has no version, name or up steps.
+func RegisterMongoMigration(m MongoMigration) {
+	mongoMigrationsMu.Lock()
+	defer mongoMigrationsMu.Unlock()
+
+	if m.Version <= 0 || m.Name == "" || len(m.Up) == 0 {
+		panic("database: RegisterMongoMigration called with incomplete migration")
+	}
+	mongoMigrations = append(mongoMigrations, m)
+}
+
+var mongoMigrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.json$`)
+
+// LoadMongoMigrations returns the registered Go migrations together with the
+// JSON migrations in dir, ordered by version. A missing directory has no
+// file migrations.
+//
+// A JSON migration holds "up" and optional "down" lists of steps in MongoDB
+// Extended JSON. A step is a database command such as createIndexes,
+// dropIndexes, create or collMod (with a $jsonSchema validator), or
+// {"updateMany": <collection>, "filter": ..., "update": ..., "batchSize": N}
+// to update matching documents in batches.
+func LoadMongoMigrations(dir string) ([]MongoMigration, error) {
+	mongoMigrationsMu.Lock()
+	migrations := append([]MongoMigration(nil), mongoMigrations...)
+	mongoMigrationsMu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		m := mongoMigrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig, err := parseMongoMigration(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		sum := sha256.Sum256(data)
+		mig.Version, mig.Name, mig.Checksum = version, m[2], hex.EncodeToString(sum[:])
+		migrations = append(migrations, mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s",
+				migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+func parseMongoMigration(data []byte) (MongoMigration, error) {
+	var file struct {
+		Up   []bson.D `bson:"up"`
+		Down []bson.D `bson:"down"`
+	}
+	if err := bson.UnmarshalExtJSON(data, false, &file); err != nil {
+		return MongoMigration{}, err
+	}
+	if len(file.Up) == 0 {
+		return MongoMigration{}, errors.New(`no "up" steps`)
+	}
+
+	var mig MongoMigration
+	for _, steps := range []struct {
+		docs []bson.D
+		ops  *[]MongoOp
+	}{{file.Up, &mig.Up}, {file.Down, &mig.Down}} {
+		for i, doc := range steps.docs {
+			op, err := parseMongoOp(doc)
+			if err != nil {
+				return MongoMigration{}, fmt.Errorf("step %d: %w", i+1, err)
+			}
+			*steps.ops = append(*steps.ops, op)
+		}
+	}
+	return mig, nil
+}
+
+func parseMongoOp(doc bson.D) (MongoOp, error) {
+	if len(doc) == 0 {
+		return nil, errors.New("empty step")
+	}
+	if doc[0].Key != "updateMany" {
+		return MongoCommand(doc), nil
+	}
+
+	op := MongoUpdateMany{}
+	for _, e := range doc {
+		var ok bool
+		switch e.Key {
+		case "updateMany":
+			op.Collection, ok = e.Value.(string)
+		case "filter":
+			op.Filter, ok = e.Value, true
+		case "update":
+			op.Update, ok = e.Value, true
+		case "batchSize":
+			switch n := e.Value.(type) {
+			case int32:
+				op.BatchSize, ok = int(n), n > 0
+			case int64:
+				op.BatchSize, ok = int(n), n > 0
+			}
+		default:
+			return nil, fmt.Errorf("updateMany: unknown key %q", e.Key)
+		}
+		if !ok {
+			return nil, fmt.Errorf("updateMany: invalid %s", e.Key)
+		}
+	}
+	if op.Collection == "" || op.Update == nil {
+		return nil, errors.New("updateMany: collection and update are required")
+	}
+	return op, nil
+}
+
+// CreateMongoMigration writes an empty JSON migration for name into dir,
+// versioned with the current UTC time, and returns its path.
+func CreateMongoMigration(dir, name string) (string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", errors.New("migration name is empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, time.Now().UTC().Format("20060102150405")+"_"+name+".json")
+	content := `{
+  "up": [
+    {"createIndexes": "collection", "indexes": [{"key": {"field": 1}, "name": "field_1"}]}
+  ],
+  "down": [
+    {"dropIndexes": "collection", "index": "field_1"}
+  ]
+}
+`
+	return path, os.WriteFile(path, []byte(content), 0o644)
+}
+
+// MongoCommand returns a step running cmd with RunCommand, e.g.
+// createIndexes, dropIndexes, create or collMod.
+func MongoCommand(cmd bson.D) MongoOp {
+	return mongoCommand(cmd)
+}
+
+type mongoCommand bson.D
+
+func (c mongoCommand) Apply(ctx context.Context, db *mongo.Database) error {
+	return db.RunCommand(ctx, bson.D(c)).Err()
+}
+
+func (c mongoCommand) Describe(ctx context.Context, db *mongo.Database) (string, error) {
+	text, err := bson.MarshalExtJSON(bson.D(c), false, false)
+	if err != nil {
+		return "", err
+	}
+	if len(c) == 0 || c[0].Key != "createIndexes" {
+		return string(text), nil
+	}
+
+	// Report which of the indexes already exist and would be left as is
+	coll, _ := c[0].Value.(string)
+	cursor, err := db.Collection(coll).Indexes().List(ctx)
+	if err != nil {
+		return "", err
+	}
+	var existing []struct {
+		Name string `bson:"name"`
+	}
+	if err := cursor.All(ctx, &existing); err != nil {
+		return "", err
+	}
+	var found []string
+	for _, idx := range existing {
+		if strings.Contains(string(text), strconv.Quote(idx.Name)) {
+			found = append(found, idx.Name)
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Sprintf("%s (existing: %s)", text, strings.Join(found, ", ")), nil
+	}
+	return string(text), nil
+}
+
+// MongoUpdateMany updates the documents of Collection matching Filter in
+// batches of BatchSize, ordered by _id, so large back-fills neither hold a
+// long-running operation nor time out. Update is an update document or an
+// aggregation pipeline.
+type MongoUpdateMany struct {
+	Collection string
+	Filter     interface{}
+	Update     interface{}
+	BatchSize  int
+}
+
+func (u MongoUpdateMany) filter() interface{} {
+	if u.Filter == nil {
+		return bson.D{}
+	}
+	return u.Filter
+}
+
+func (u MongoUpdateMany) Apply(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection(u.Collection)
+	size := u.BatchSize
+	if size <= 0 {
+		size = DefaultMongoBatchSize
+	}
+
+	var last interface{}
+	for {
+		filter := bson.D{{Key: "$and", Value: bson.A{u.filter()}}}
+		if last != nil {
+			filter = bson.D{{Key: "$and", Value: bson.A{u.filter(), bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: last}}}}}}}
+		}
+		cursor, err := coll.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetProjection(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(int64(size)))
+		if err != nil {
+			return err
+		}
+		var docs []struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		ids := make(bson.A, len(docs))
+		for i, doc := range docs {
+			ids[i] = doc.ID
+		}
+		if _, err := coll.UpdateMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, u.Update); err != nil {
+			return err
+		}
+		if len(docs) < size {
+			return nil
+		}
+		last = docs[len(docs)-1].ID
+	}
+}
+
+func (u MongoUpdateMany) Describe(ctx context.Context, db *mongo.Database) (string, error) {
+	n, err := db.Collection(u.Collection).CountDocuments(ctx, u.filter())
+	if err != nil {
+		return "", err
+	}
+	update, err := bson.MarshalExtJSON(bson.D{{Key: "update", Value: u.Update}}, false, false)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("updateMany %s: %d matching documents, %s", u.Collection, n, update), nil
+}
+
+// MongoFunc returns a step running fn; description is reported by dry runs.
+func MongoFunc(description string, fn func(ctx context.Context, db *mongo.Database) error) MongoOp {
+	return mongoFunc{description: description, fn: fn}
+}
+
+type mongoFunc struct {
+	description string
+	fn          func(ctx context.Context, db *mongo.Database) error
+}
+
+func (f mongoFunc) Apply(ctx context.Context, db *mongo.Database) error {
+	return f.fn(ctx, db)
+}
+
+func (f mongoFunc) Describe(context.Context, *mongo.Database) (string, error) {
+	return f.description, nil
+}
+
+// MongoMigrator applies MongoDB migrations and records them in
+// MongoMigrationsCollection. A lock document in the same collection keeps
+// instances starting at the same time from applying a migration twice.
+type MongoMigrator struct {
+	db         *mongo.Database
+	migrations []MongoMigration
+}
+
+// NewMongoMigrator returns a MongoMigrator for db.
+func NewMongoMigrator(db *mongo.Database, migrations []MongoMigration) *MongoMigrator {
+	return &MongoMigrator{db: db, migrations: migrations}
+}
+
+// Migrator returns a MongoMigrator for the registered migrations and the
+// JSON migrations in dir.
+func (s *MongoStore) Migrator(dir string) (SchemaMigrator, error) {
+	migrations, err := LoadMongoMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewMongoMigrator(s.Database, migrations), nil
+}
+
+type mongoMigrationRecord struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	Checksum  string    `bson:"checksum"`
+	Dirty     bool      `bson:"dirty"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+func (m *MongoMigrator) collection() *mongo.Collection {
+	return m.db.Collection(MongoMigrationsCollection)
+}
+
+// Status lists every migration, applied or pending, ordered by version.
+func (m *MongoMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []MigrationStatus
+	seen := make(map[int64]bool)
+	for _, mig := range m.migrations {
+		seen[mig.Version] = true
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if rec, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt, s.Dirty = true, rec.AppliedAt, rec.Dirty
+			s.Modified = rec.Checksum != mig.Checksum
+		}
+		list = append(list, s)
+	}
+	for _, rec := range applied {
+		if !seen[rec.Version] {
+			list = append(list, MigrationStatus{
+				Version: rec.Version, Name: rec.Name, Applied: true,
+				AppliedAt: rec.AppliedAt, Dirty: rec.Dirty, Missing: true,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Up applies up to limit pending migrations in version order; a limit of 0
+// applies all of them.
+func (m *MongoMigrator) Up(ctx context.Context, limit int) ([]MigrationStatus, error) {
+	return m.run(ctx, limit, false)
+}
+
+// Down reverts up to limit applied migrations, newest first; a limit of 0
+// reverts one.
+func (m *MongoMigrator) Down(ctx context.Context, limit int) ([]MigrationStatus, error) {
+	return m.run(ctx, max(limit, 1), true)
+}
+
+func (m *MongoMigrator) run(ctx context.Context, limit int, down bool) ([]MigrationStatus, error) {
+	var done []MigrationStatus
+	err := m.withLock(ctx, func() error {
+		selected, err := m.pending(ctx, limit, down)
+		if err != nil {
+			return err
+		}
+		for _, mig := range selected {
+			if err := m.apply(ctx, mig, !down); err != nil {
+				return err
+			}
+			done = append(done, MigrationStatus{
+				Version: mig.Version, Name: mig.Name, Applied: !down, AppliedAt: time.Now(),
+			})
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Redo reverts and re-applies the newest applied migration.
+func (m *MongoMigrator) Redo(ctx context.Context) (MigrationStatus, error) {
+	var redone MigrationStatus
+	err := m.withLock(ctx, func() error {
+		last, err := m.pending(ctx, 1, true)
+		if err != nil {
+			return err
+		}
+		if len(last) == 0 {
+			return errors.New("no applied migration to redo")
+		}
+		if err := m.apply(ctx, last[0], false); err != nil {
+			return err
+		}
+		if err := m.apply(ctx, last[0], true); err != nil {
+			return err
+		}
+		redone = MigrationStatus{Version: last[0].Version, Name: last[0].Name, Applied: true, AppliedAt: time.Now()}
+		return nil
+	})
+	return redone, err
+}
+
+// Plan describes each step Up (or Down if down is set) would run with the
+// same limit, without changing the database: the commands, which indexes
+// already exist and how many documents batched updates would match.
+func (m *MongoMigrator) Plan(ctx context.Context, limit int, down bool) ([]PlannedStep, error) {
+	if down {
+		limit = max(limit, 1)
+	}
+	selected, err := m.pending(ctx, limit, down)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []PlannedStep
+	for _, mig := range selected {
+		ops := mig.Up
+		if down {
+			ops = mig.Down
+		}
+		for _, op := range ops {
+			change, err := op.Describe(ctx, m.db)
+			if err != nil {
+				return nil, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			steps = append(steps, PlannedStep{Version: mig.Version, Name: mig.Name, Change: change})
+		}
+	}
+	return steps, nil
+}
+
+// Force records version as the newest applied migration without running
+// it: it and every earlier migration are marked applied and clean, and the
+// records of later versions are removed. Version 0 removes every record.
+func (m *MongoMigrator) Force(ctx context.Context, version int64) error {
+	found := version == 0
+	for _, mig := range m.migrations {
+		found = found || mig.Version == version
+	}
+	if !found {
+		return fmt.Errorf("no migration for version %d", version)
+	}
+
+	return m.withLock(ctx, func() error {
+		coll := m.collection()
+		_, err := coll.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{
+			{Key: "$gt", Value: version},
+			{Key: "$type", Value: "long"},
+		}}})
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			_, err := coll.UpdateOne(ctx,
+				bson.D{{Key: "_id", Value: mig.Version}},
+				bson.D{
+					{Key: "$set", Value: bson.D{{Key: "checksum", Value: mig.Checksum}, {Key: "dirty", Value: false}}},
+					{Key: "$setOnInsert", Value: bson.D{{Key: "name", Value: mig.Name}, {Key: "applied_at", Value: time.Now()}}},
+				},
+				options.Update().SetUpsert(true))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// pending returns the migrations to run, refusing while a migration is
+// dirty or an applied one was modified.
+func (m *MongoMigrator) pending(ctx context.Context, limit int, down bool) ([]MongoMigration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range applied {
+		if rec.Dirty {
+			return nil, fmt.Errorf("migration %d_%s is dirty: fix the database, then run `gorbit migrate force` with the last good version", rec.Version, rec.Name)
+		}
+	}
+
+	versions := make([]int64, len(m.migrations))
+	for i, mig := range m.migrations {
+		versions[i] = mig.Version
+		if rec, ok := applied[mig.Version]; ok && rec.Checksum != mig.Checksum {
+			return nil, fmt.Errorf("migration %d_%s was modified after it was applied", mig.Version, mig.Name)
+		}
+	}
+	done := func(version int64) bool {
+		_, ok := applied[version]
+		return ok
+	}
+
+	var selected []MongoMigration
+	for _, i := range selectMigrations(versions, done, limit, down) {
+		selected = append(selected, m.migrations[i])
+	}
+	return selected, nil
+}
+
+func (m *MongoMigrator) applied(ctx context.Context) (map[int64]mongoMigrationRecord, error) {
+	cursor, err := m.collection().Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$type", Value: "long"}}}})
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", MongoMigrationsCollection, err)
+	}
+	var records []mongoMigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("read %s: %w", MongoMigrationsCollection, err)
+	}
+	applied := make(map[int64]mongoMigrationRecord, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+// apply runs the steps of one migration and updates its record, which is
+// marked dirty while they run. MongoDB cannot roll back index or collection
+// changes, so a failure leaves the migration dirty.
+func (m *MongoMigrator) apply(ctx context.Context, mig MongoMigration, up bool) error {
+	ops, direction := mig.Up, "up"
+	if !up {
+		ops, direction = mig.Down, "down"
+		if len(mig.Down) == 0 {
+			return fmt.Errorf("migration %d_%s has no down steps", mig.Version, mig.Name)
+		}
+	}
+
+	coll := m.collection()
+	start := time.Now()
+	err := func() error {
+		var err error
+		if up {
+			_, err = coll.InsertOne(ctx, mongoMigrationRecord{
+				Version: mig.Version, Name: mig.Name, Checksum: mig.Checksum, Dirty: true, AppliedAt: start,
+			})
+		} else {
+			_, err = coll.UpdateByID(ctx, mig.Version, bson.D{{Key: "$set", Value: bson.D{{Key: "dirty", Value: true}}}})
+		}
+		if err != nil {
+			return err
+		}
+
+		for i, op := range ops {
+			if err := op.Apply(ctx, m.db); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+
+		if up {
+			_, err = coll.UpdateByID(ctx, mig.Version, bson.D{{Key: "$set", Value: bson.D{{Key: "dirty", Value: false}}}})
+		} else {
+			_, err = coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: mig.Version}})
+		}
+		return err
+	}()
+	if err != nil {
+		return fmt.Errorf("migration %d_%s %s failed: %w", mig.Version, mig.Name, direction, err)
+	}
+
+	slog.Info("Applied migration",
+		"store", MongoDriver,
+		"version", mig.Version,
+		"name", mig.Name,
+		"direction", direction,
+		"duration", time.Since(start),
+	)
+	return nil
+}
+
+// withLock runs fn holding the migration lock document. The lock records
+// its owner and is refreshed while fn runs; a lock left behind by a
+// process that died is taken over once it expires.
+func (m *MongoMigrator) withLock(ctx context.Context, fn func() error) error {
+	coll := m.collection()
+	owner := primitive.NewObjectID()
+	for {
+		now := time.Now()
+		_, err := coll.InsertOne(ctx, bson.D{
+			{Key: "_id", Value: mongoLockID},
+			{Key: "owner", Value: owner},
+			{Key: "locked_at", Value: now},
+			{Key: "expires_at", Value: now.Add(mongoLockTTL)},
+		})
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+
+		_, err = coll.DeleteOne(ctx, bson.D{
+			{Key: "_id", Value: mongoLockID},
+			{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}},
+		})
+		if err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("acquire migration lock: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+	held := bson.D{{Key: "_id", Value: mongoLockID}, {Key: "owner", Value: owner}}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.refreshLock(held, stop)
+	}()
+
+	defer func() {
+		close(stop)
+		wg.Wait()
+		// The lock is released even if the migration context was canceled,
+		// unless another run has taken it over
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := coll.DeleteOne(ctx, held); err != nil {
+			slog.Warn("Failed to release migration lock", "store", MongoDriver, "error", err)
+		}
+	}()
+	return fn()
+}
+
+// refreshLock extends the lock matched by held every mongoLockRefresh
+// until stop is closed.
+func (m *MongoMigrator) refreshLock(held bson.D, stop <-chan struct{}) {
+	ticker := time.NewTicker(mongoLockRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), mongoLockRefresh)
+		res, err := m.collection().UpdateOne(ctx, held, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "expires_at", Value: time.Now().Add(mongoLockTTL)},
+		}}})
+		cancel()
+		switch {
+		case err != nil:
+			slog.Warn("Failed to refresh migration lock", "store", MongoDriver, "error", err)
+		case res.MatchedCount == 0:
+			slog.Error("Migration lock was taken over by another run", "store", MongoDriver)
+			return
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// internal/database/mongo_repository.go
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// MongoRepository is a Repository over a collection of T documents.
+type MongoRepository[T any] struct {
+	coll  *mongo.Collection
+	model func() (*mongoModel, error)
+}
+
+// mongoModel is the model of a document type and where its primary key and
+// timestamps are.
+type mongoModel struct {
+	*model
+	keyIndex  []int
+	createdAt []int
+	updatedAt []int
+}
+
+// NewMongoRepository returns a repository for the T documents of coll. T
+// must be a struct with an _id field. An empty ObjectID _id is generated
+// on Create, and CreatedAt and UpdatedAt time.Time fields are maintained.
+func NewMongoRepository[T any](coll *mongo.Collection) *MongoRepository[T] {
+	r := &MongoRepository[T]{coll: coll}
+	r.model = sync.OnceValues(parseMongoModel[T])
+	return r
+}
+
+func parseMongoModel[T any]() (*mongoModel, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", typ)
+	}
+	m := &mongoModel{model: &model{fields: make(map[string]*modelField)}}
+	m.addFields(typ, nil)
+	if m.model.key == nil {
+		return nil, fmt.Errorf("%s has no _id field", typ)
+	}
+	return m, nil
+}
+
+// addFields adds the fields of typ under the BSON keys the driver uses,
+// descending into inline structs.
+func (m *mongoModel) addFields(typ reflect.Type, index []int) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, flags, _ := strings.Cut(sf.Tag.Get("bson"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if strings.Contains(","+flags+",", ",inline,") && sf.Type.Kind() == reflect.Struct {
+			m.addFields(sf.Type, fieldIndex)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+
+		f := &modelField{
+			name:     name,
+			typ:      sf.Type,
+			nullable: sf.Type.Kind() == reflect.Ptr,
+			value: func(record reflect.Value) any {
+				return record.FieldByIndex(fieldIndex).Interface()
+			},
+		}
+		if f.nullable {
+			f.typ = sf.Type.Elem()
+		}
+		m.fields[name] = f
+
+		switch {
+		case name == "_id":
+			m.model.key, m.keyIndex = f, fieldIndex
+		case sf.Name == "CreatedAt" && sf.Type == timeType:
+			m.createdAt = fieldIndex
+		case sf.Name == "UpdatedAt" && sf.Type == timeType:
+			m.updatedAt = fieldIndex
+		}
+	}
+}
+
+func (r *MongoRepository[T]) Create(ctx context.Context, record *T) error {
+	m, err := r.model()
+	if err != nil {
+		return err
+	}
+	doc := reflect.ValueOf(record).Elem()
+	key := doc.FieldByIndex(m.keyIndex)
+	if key.Type() == objectIDType && key.IsZero() {
+		key.Set(reflect.ValueOf(primitive.NewObjectID()))
+	}
+	now := time.Now().UTC()
+	if m.createdAt != nil && doc.FieldByIndex(m.createdAt).IsZero() {
+		doc.FieldByIndex(m.createdAt).Set(reflect.ValueOf(now))
+	}
+	if m.updatedAt != nil {
+		doc.FieldByIndex(m.updatedAt).Set(reflect.ValueOf(now))
+	}
+
+	res, err := r.coll.InsertOne(ctx, record)
+	if err != nil {
+		return err
+	}
+	// Keys left empty are generated by the driver
+	if id := reflect.ValueOf(res.InsertedID); key.IsZero() && id.IsValid() && id.Type().AssignableTo(key.Type()) {
+		key.Set(id)
+	}
+	return nil
+}
+
+func (r *MongoRepository[T]) Get(ctx context.Context, id string) (*T, error) {
+	filter, err := r.byKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	record := new(T)
+	if err := r.coll.FindOne(ctx, filter).Decode(record); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *MongoRepository[T]) Update(ctx context.Context, record *T) error {
+	m, err := r.model()
+	if err != nil {
+		return err
+	}
+	doc := reflect.ValueOf(record).Elem()
+	if m.updatedAt != nil {
+		doc.FieldByIndex(m.updatedAt).Set(reflect.ValueOf(time.Now().UTC()))
+	}
+
+	res, err := r.coll.ReplaceOne(ctx, bson.M{"_id": doc.FieldByIndex(m.keyIndex).Interface()}, record)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepository[T]) Delete(ctx context.Context, id string) error {
+	filter, err := r.byKey(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// byKey returns the filter selecting the document with the given ID; IDs
+// that cannot be an _id are not found.
+func (r *MongoRepository[T]) byKey(id string) (bson.M, error) {
+	m, err := r.model()
+	if err != nil {
+		return nil, err
+	}
+	key, err := m.parseKey(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return bson.M{"_id": key}, nil
+}
+
+func (r *MongoRepository[T]) List(ctx context.Context, opts ListOptions) (Page[T], error) {
+	m, err := r.model()
+	if err != nil {
+		return Page[T]{}, err
+	}
+	p, err := m.plan(opts)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	conditions := bson.A{}
+	for _, c := range p.conditions {
+		conditions = append(conditions, mongoCondition(c))
+	}
+	filter := bson.M{}
+	if len(conditions) > 0 {
+		filter["$and"] = conditions
+	}
+	var total *int64
+	if p.total {
+		n, err := r.coll.CountDocuments(ctx, filter)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		total = &n
+	}
+
+	if p.after != nil {
+		terms := bson.A{}
+		for _, t := range p.keysetTerms() {
+			term := bson.A{}
+			for _, c := range t.equal {
+				term = append(term, mongoCondition(c))
+			}
+			terms = append(terms, bson.M{"$and": append(term, mongoCondition(t.after))})
+		}
+		filter["$and"] = append(conditions, bson.M{"$or": terms})
+	}
+	sort := bson.D{}
+	for _, s := range p.sort {
+		dir := 1
+		if s.desc {
+			dir = -1
+		}
+		sort = append(sort, bson.E{Key: s.field.name, Value: dir})
+	}
+
+	find := options.Find().
+		SetSort(sort).
+		SetLimit(int64(p.limit + 1)).
+		SetSkip(int64(p.offset))
+	cursor, err := r.coll.Find(ctx, filter, find)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	items := []T{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return Page[T]{}, err
+	}
+	return newPage(p, items, total)
+}
+
+func mongoCondition(c condition) bson.M {
+	var cond any
+	switch c.op {
+	case OpNe:
+		cond = bson.M{"$ne": c.value}
+	case OpGt:
+		cond = bson.M{"$gt": c.value}
+	case OpGte:
+		cond = bson.M{"$gte": c.value}
+	case OpLt:
+		cond = bson.M{"$lt": c.value}
+	case OpLte:
+		cond = bson.M{"$lte": c.value}
+	case OpIn:
+		cond = bson.M{"$in": c.value}
+	case OpContains:
+		cond = bson.M{"$regex": regexp.QuoteMeta(c.value.(string))}
+	case OpNull:
+		// Null matches missing fields too, as left out by omitempty
+		if c.value.(bool) {
+			cond = bson.M{"$eq": nil}
+		} else {
+			cond = bson.M{"$ne": nil}
+		}
+	default:
+		cond = bson.M{"$eq": c.value}
+	}
+	return bson.M{c.field.name: cond}
+}
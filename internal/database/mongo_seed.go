@@ -0,0 +1,67 @@
+// internal/database/mongo_seed.go
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Seed loads fixtures into the collections of the configured database.
+// Documents are upserted by the fixture key, _id by default, and inserted
+// when they lack it. Values are read as Extended JSON, so {"$oid": ...} and
+// {"$date": ...} become ObjectIDs and dates.
+func (s *MongoStore) Seed(ctx context.Context, fixtures []Fixture, opts SeedOptions) ([]SeedResult, error) {
+	var results []SeedResult
+	for _, f := range fixtures {
+		coll := s.Database.Collection(f.Name)
+		if opts.Reset {
+			if _, err := coll.DeleteMany(ctx, bson.D{}); err != nil {
+				return results, fmt.Errorf("reset %s: %w", f.Name, err)
+			}
+		}
+
+		key := f.Key
+		if len(key) == 0 {
+			key = []string{"_id"}
+		}
+		for i, row := range f.Rows {
+			doc, err := mongoDocument(row)
+			if err != nil {
+				return results, fmt.Errorf("%s row %d: %w", f.Name, i+1, err)
+			}
+
+			filter := bson.D{}
+			for _, k := range key {
+				if v, ok := doc[k]; ok {
+					filter = append(filter, bson.E{Key: k, Value: v})
+				}
+			}
+			if len(filter) < len(key) {
+				_, err = coll.InsertOne(ctx, doc)
+			} else {
+				_, err = coll.ReplaceOne(ctx, filter, doc, options.Replace().SetUpsert(true))
+			}
+			if err != nil {
+				return results, fmt.Errorf("%s row %d: %w", f.Name, i+1, err)
+			}
+		}
+		results = append(results, SeedResult{Name: f.Name, Rows: len(f.Rows)})
+	}
+	return results, nil
+}
+
+func mongoDocument(row map[string]any) (bson.M, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.UnmarshalExtJSON(data, false, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -3,48 +3,206 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"strconv"
 	"time"
 
 	"gorbit/internal/config"
+	"gorbit/pkg/utils"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
-func InitMongoDB(cfg *config.Config) (*mongo.Client, error) {
-	// Create MongoDB connection string
-	connectionString := fmt.Sprintf("mongodb://%s:%s@%s:%d/%s?authSource=%s&authMechanism=%s",
-		cfg.Databases.MongoDB.Username,
-		cfg.Databases.MongoDB.Password,
-		cfg.Databases.MongoDB.Host,
-		cfg.Databases.MongoDB.Port,
-		cfg.Databases.MongoDB.Database,
-		cfg.Databases.MongoDB.AuthSource,
-		cfg.Databases.MongoDB.AuthMechanism,
-	)
+// MongoDriver is the registry name of the MongoDB datastore.
+const MongoDriver = "mongodb"
+
+func init() {
+	Register(Driver{
+		Name:     MongoDriver,
+		Order:    30,
+		Critical: true,
+		Enabled: func(cfg *config.Config) bool {
+			return cfg.Databases.MongoDB.Enabled
+		},
+		Open: func(ctx context.Context, cfg *config.Config) (Store, error) {
+			return InitMongoDB(ctx, cfg)
+		},
+		Retry: func(cfg *config.Config) config.RetryPolicy {
+			return cfg.Databases.MongoDB.Retry
+		},
+		CreateMigration: func(dir, name string) ([]string, error) {
+			path, err := CreateMongoMigration(dir, name)
+			if err != nil {
+				return nil, err
+			}
+			return []string{path}, nil
+		},
+	})
+}
+
+// MongoStore adapts a MongoDB client to the Store interface.
+type MongoStore struct {
+	Client *mongo.Client
+	// Database is the configured database
+	Database *mongo.Database
+}
 
-	// Set client options
-	clientOptions := options.Client().ApplyURI(connectionString)
+// Ping verifies the primary is reachable.
+func (s *MongoStore) Ping(ctx context.Context) error {
+	return s.Client.Ping(ctx, nil)
+}
+
+// Close disconnects the client.
+func (s *MongoStore) Close(ctx context.Context) error {
+	return s.Client.Disconnect(ctx)
+}
 
-	// Set context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Mongo returns the MongoDB store, if the datastore is enabled.
+func (r *Registry) Mongo() (*MongoStore, bool) {
+	store, ok := r.Get(MongoDriver)
+	if !ok {
+		return nil, false
+	}
+	mongoStore, ok := store.(*MongoStore)
+	return mongoStore, ok
+}
+
+// InitMongoDB connects to MongoDB and pings it. The returned store holds
+// the client and the configured database.
+func InitMongoDB(ctx context.Context, cfg *config.Config) (*MongoStore, error) {
+	c := cfg.Databases.MongoDB
+	clientOptions, err := mongoOptions(c)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("mongodb configuration: %w", err))
+	}
+
+	timeout := c.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// Connect to MongoDB
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Printf("Failed to connect to MongoDB: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("mongodb connection failed: %w", err)
+	}
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongodb ping failed: %w", err)
 	}
 
-	// Verify the connection
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Printf("Failed to ping MongoDB: %v", err)
-		return nil, err
+	slog.Info("MongoDB connection established",
+		"hosts", clientOptions.Hosts,
+		"replica_set", c.ReplicaSet,
+		"database", c.Database,
+	)
+	return &MongoStore{Client: client, Database: client.Database(c.Database)}, nil
+}
+
+// mongoOptions builds the client options from the URI, or from the host
+// settings without one, then applies the explicit settings on top.
+func mongoOptions(c config.MongoDatabase) (*options.ClientOptions, error) {
+	opts := options.Client()
+	switch {
+	case c.URI != "":
+		opts.ApplyURI(c.URI)
+	case c.SRV:
+		if c.Host == "" {
+			return nil, errors.New("srv requires host")
+		}
+		opts.ApplyURI("mongodb+srv://" + c.Host)
+	case len(c.Hosts) > 0:
+		opts.SetHosts(c.Hosts)
+	case c.Host != "":
+		port := c.Port
+		if port == 0 {
+			port = 27017
+		}
+		opts.SetHosts([]string{net.JoinHostPort(c.Host, strconv.Itoa(port))})
+	default:
+		return nil, errors.New("one of uri, host or hosts is required")
+	}
+
+	if c.Username != "" {
+		// Set as options rather than in the URI so credentials need no escaping
+		opts.SetAuth(options.Credential{
+			AuthMechanism: c.AuthMechanism,
+			AuthSource:    c.AuthSource,
+			Username:      c.Username,
+			Password:      c.Password,
+		})
+	}
+	if c.ReplicaSet != "" {
+		opts.SetReplicaSet(c.ReplicaSet)
+	}
+
+	if c.TLS || c.TLSCAFile != "" || c.TLSCertFile != "" {
+		tlsConfig, err := utils.LoadTLSConfig(c.TLSCAFile, c.TLSCertFile, c.TLSKeyFile, c.TLSInsecure)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(c.MaxConnIdleTime)
+	}
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(c.ConnectTimeout)
+	}
+	if c.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+	}
+
+	if c.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(c.ReadPreference)
+		if err != nil {
+			return nil, fmt.Errorf("read_preference: %w", err)
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("read_preference: %w", err)
+		}
+		opts.SetReadPreference(rp)
+	}
+	if c.ReadConcern != "" {
+		opts.SetReadConcern(&readconcern.ReadConcern{Level: c.ReadConcern})
+	}
+	if c.WriteConcern != "" || c.WriteJournal || c.WriteTimeout > 0 {
+		wc := &writeconcern.WriteConcern{WTimeout: c.WriteTimeout}
+		if n, err := strconv.Atoi(c.WriteConcern); err == nil {
+			wc.W = n
+		} else if c.WriteConcern != "" {
+			wc.W = c.WriteConcern
+		}
+		if c.WriteJournal {
+			wc.Journal = &c.WriteJournal
+		}
+		opts.SetWriteConcern(wc)
+	}
+
+	for _, name := range c.Compressors {
+		if name != "snappy" && name != "zlib" && name != "zstd" {
+			return nil, fmt.Errorf("compressors: unknown compressor %q", name)
+		}
+	}
+	if len(c.Compressors) > 0 {
+		opts.SetCompressors(c.Compressors)
 	}
 
-	return client, nil
+	return opts, opts.Validate()
 }
@@ -3,61 +3,289 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorbit/internal/config"
 
+	gomysql "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-func InitMySQL(cfg *config.Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		cfg.Databases.MySQL.Username,
-		cfg.Databases.MySQL.Password,
-		cfg.Databases.MySQL.Host,
-		cfg.Databases.MySQL.Port,
-		cfg.Databases.MySQL.Database,
-	)
+// MySQLDriver is the registry name of the MySQL datastore.
+const MySQLDriver = "mysql"
 
-	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+func init() {
+	Register(Driver{
+		Name:     MySQLDriver,
+		Order:    10,
+		Critical: true,
+		Enabled: func(cfg *config.Config) bool {
+			return cfg.Databases.MySQL.Enabled
+		},
+		Open: func(ctx context.Context, cfg *config.Config) (Store, error) {
+			db, err := InitMySQL(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+			return &SQLStore{DB: db}, nil
+		},
+		Retry: func(cfg *config.Config) config.RetryPolicy {
+			return cfg.Databases.MySQL.Retry
+		},
+		Retryable:       mysqlRetryable,
+		CreateMigration: createSQLMigration,
+	})
+}
+
+// mysqlRetryable reports deadlocks (ER_LOCK_DEADLOCK), InnoDB's only
+// conflict that rolls back the whole transaction.
+func mysqlRetryable(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1213
+}
+
+// mysqlTLSConfig prefixes the names the TLS settings of each server are
+// registered under with the MySQL driver.
+const mysqlTLSConfig = "gorbit"
+
+// mysqlParamNames restores the case of the MySQL driver options, since
+// configuration keys are lower-cased when loaded. mysqlDSN applies them to
+// their driver settings; other params are session variables, which are
+// lower case.
+var mysqlParamNames = func() map[string]string {
+	names := make(map[string]string)
+	for _, name := range []string{
+		"allowAllFiles", "allowCleartextPasswords", "allowFallbackToPlaintext",
+		"allowNativePasswords", "allowOldPasswords", "charset", "checkConnLiveness",
+		"clientFoundRows", "collation", "columnsWithAlias", "connectionAttributes",
+		"interpolateParams", "maxAllowedPacket", "multiStatements", "parseTime",
+		"readTimeout", "rejectReadOnly", "serverPubKey", "timeTruncate", "writeTimeout",
+	} {
+		names[strings.ToLower(name)] = name
 	}
+	return names
+}()
 
-	if cfg.Server.Debug {
-		gormConfig.Logger = logger.Default.LogMode(logger.Info)
+func InitMySQL(ctx context.Context, cfg *config.Config) (*gorm.DB, error) {
+	c := cfg.Databases.MySQL
+	mc, err := mysqlDSN(c)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("mysql configuration: %w", err))
 	}
+	connector, err := gomysql.NewConnector(mc)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("mysql configuration: %w", err))
+	}
+	pool := sql.OpenDB(connector)
+	db, err := openSQL(ctx, MySQLDriver, pool, mysql.New(mysql.Config{Conn: pool, DSNConfig: mc}), c, NewQueryLogger(MySQLDriver, cfg.Databases.QueryLog))
+	if err != nil {
+		return nil, err
+	}
+	if err := useReplicas(db, MySQLDriver, c, mysqlReplica, mysqlReplicaLag); err != nil {
+		closeSQL(db)
+		return nil, err
+	}
+	return db, nil
+}
 
-	db, err := gorm.Open(mysql.Open(dsn), gormConfig)
+// mysqlReplica skips the server version query, so that opening a replica
+// does not connect to it. The pool is built from a connector as for the
+// primary, since FormatDSN drops the connection attributes.
+func mysqlReplica(c config.SQLDatabase) (gorm.Dialector, error) {
+	mc, err := mysqlDSN(c)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := gomysql.NewConnector(mc)
 	if err != nil {
-		return nil, fmt.Errorf("mysql connection failed: %w", err)
+		return nil, err
 	}
+	return mysql.New(mysql.Config{Conn: sql.OpenDB(connector), DSNConfig: mc, SkipInitializeWithVersion: true}), nil
+}
 
-	sqlDB, err := db.DB()
+// mysqlReplicaLag reads Seconds_Behind_Source from SHOW REPLICA STATUS,
+// falling back to SHOW SLAVE STATUS before MySQL 8.0.22.
+func mysqlReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("mysql pool setup failed: %w", err)
+		return 0, err
 	}
+	defer rows.Close()
 
-	// Connection pool settings
-	sqlDB.SetMaxOpenConns(cfg.Databases.MySQL.MaxOpenConns)
-	sqlDB.SetMaxIdleConns(cfg.Databases.MySQL.MaxIdleConns)
-	sqlDB.SetConnMaxLifetime(time.Duration(cfg.Databases.MySQL.ConnMaxLifetime) * time.Minute)
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("not a replica")
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, errors.New("replication is not running")
+		}
+		seconds, err := strconv.ParseInt(values[i].String, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", column, err)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("replica status has no Seconds_Behind_Source")
+}
 
-	// Verify connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// mysqlDSN maps c onto the MySQL driver settings: SSL modes onto TLS
+// settings, the statement timeout onto max_execution_time (which only
+// bounds SELECT statements), and the application name onto the
+// program_name connection attribute.
+func mysqlDSN(c config.SQLDatabase) (*gomysql.Config, error) {
+	tz := timezone(c)
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("timezone: %w", err)
+	}
 
-	if err := sqlDB.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("mysql ping failed: %w", err)
+	mc := gomysql.NewConfig()
+	mc.User = c.Username
+	mc.Passwd = c.Password
+	mc.Net = "tcp"
+	mc.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	mc.DBName = c.Database
+	mc.ParseTime = true
+	mc.Loc = loc
+	mc.Timeout = c.ConnectTimeout
+	mc.Params = map[string]string{
+		"charset": "utf8mb4",
+		// Named zones need the MySQL time zone tables; UTC works without
+		"time_zone": "'" + strings.ReplaceAll(tz, "'", "") + "'",
+	}
+	if tz == "UTC" {
+		mc.Params["time_zone"] = "'+00:00'"
+	}
+	if c.StatementTimeout > 0 {
+		mc.Params["max_execution_time"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
+	}
+	for k, v := range c.Params {
+		if name, ok := mysqlParamNames[strings.ToLower(k)]; ok {
+			k = name
+		}
+		mc.Params[k] = v
 	}
 
-	slog.Info("MySQL connection established",
-		"host", cfg.Databases.MySQL.Host,
-		"database", cfg.Databases.MySQL.Database,
-	)
+	switch mode := sslMode(c); mode {
+	case "disable":
+		mc.TLSConfig = "false"
+	case "prefer":
+		mc.TLSConfig = "preferred"
+	default:
+		tlsConfig, err := sqlTLSConfig(c, mode)
+		if err != nil {
+			return nil, err
+		}
+		// Registered per server, since the host name is verified
+		name := mysqlTLSConfig + ":" + mc.Addr
+		if err := gomysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+			return nil, err
+		}
+		mc.TLSConfig = name
+	}
 
-	return db, nil
+	// The driver sends every param but charset as SET k = v: a round trip
+	// through the DSN moves the driver options into their settings
+	parsed, err := gomysql.ParseDSN(mc.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("params: %w", err)
+	}
+	parsed.User, parsed.Passwd = mc.User, mc.Passwd
+	if c.ApplicationName != "" {
+		attrs := "program_name:" + c.ApplicationName
+		if parsed.ConnectionAttributes != "" {
+			attrs = parsed.ConnectionAttributes + "," + attrs
+		}
+		parsed.ConnectionAttributes = attrs
+	}
+	return parsed, nil
+}
+
+// sqlTLSConfig builds the TLS settings of the require, verify-ca and
+// verify-full modes. Without sslrootcert the system roots are used.
+func sqlTLSConfig(c config.SQLDatabase, mode string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: c.Host, MinVersion: tls.VersionTLS12}
+
+	if c.SSLCert != "" || c.SSLKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.SSLCert, c.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("sslcert/sslkey: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if c.SSLRootCert != "" {
+		pem, err := os.ReadFile(c.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("sslrootcert: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("sslrootcert: no certificates in %s", c.SSLRootCert)
+		}
+	}
+	tlsConfig.RootCAs = roots
+
+	switch mode {
+	case "require":
+		tlsConfig.InsecureSkipVerify = true
+	case "verify-ca":
+		// Verify the chain but not the host name
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs[i] = cert
+			}
+			if len(certs) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+	return tlsConfig, nil
 }
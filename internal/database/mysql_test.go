@@ -0,0 +1,183 @@
+// internal/database/mysql_test.go
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gorbit/internal/config"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+func mysqlTestConfig() config.SQLDatabase {
+	return config.SQLDatabase{
+		Host:     "db.internal",
+		Port:     3306,
+		Username: "app",
+		Password: "secret",
+		Database: "myapp",
+	}
+}
+
+// Every Params entry but charset is sent to the server as SET k = v, so
+// only session variables may end up there.
+func TestMySQLDSNSessionParams(t *testing.T) {
+	c := mysqlTestConfig()
+	c.ApplicationName = "gorbit"
+	c.StatementTimeout = 5 * time.Second
+	c.Params = map[string]string{"sql_mode": "'STRICT_ALL_TABLES'"}
+
+	mc, err := mysqlDSN(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"charset":            "utf8mb4",
+		"time_zone":          "'+00:00'",
+		"max_execution_time": "5000",
+		"sql_mode":           "'STRICT_ALL_TABLES'",
+	}
+	if !reflect.DeepEqual(mc.Params, want) {
+		t.Errorf("Params = %v, want %v", mc.Params, want)
+	}
+	if mc.ConnectionAttributes != "program_name:gorbit" {
+		t.Errorf("ConnectionAttributes = %q, want %q", mc.ConnectionAttributes, "program_name:gorbit")
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		name    string
+		set     func(c *config.SQLDatabase)
+		check   func(t *testing.T, mc *gomysql.Config)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			set:  func(c *config.SQLDatabase) {},
+			check: func(t *testing.T, mc *gomysql.Config) {
+				if mc.Addr != "db.internal:3306" || mc.User != "app" || mc.Passwd != "secret" || mc.DBName != "myapp" {
+					t.Errorf("connection = %s@%s/%s", mc.User, mc.Addr, mc.DBName)
+				}
+				if !mc.ParseTime || mc.Loc != time.UTC || mc.Params["time_zone"] != "'+00:00'" {
+					t.Errorf("timezone = %v, %q", mc.Loc, mc.Params["time_zone"])
+				}
+				if mc.TLSConfig != "false" || mc.TLS != nil {
+					t.Errorf("TLS = %q, %v; want disabled", mc.TLSConfig, mc.TLS)
+				}
+				if mc.ConnectionAttributes != "" {
+					t.Errorf("ConnectionAttributes = %q, want none", mc.ConnectionAttributes)
+				}
+			},
+		},
+		{
+			name: "password with DSN delimiters",
+			set:  func(c *config.SQLDatabase) { c.Password = "p@ss:w/rd?x=1" },
+			check: func(t *testing.T, mc *gomysql.Config) {
+				if mc.Passwd != "p@ss:w/rd?x=1" {
+					t.Errorf("Passwd = %q", mc.Passwd)
+				}
+			},
+		},
+		{
+			name: "named timezone",
+			set:  func(c *config.SQLDatabase) { c.Timezone = "Europe/Berlin" },
+			check: func(t *testing.T, mc *gomysql.Config) {
+				if mc.Loc.String() != berlin.String() || mc.Params["time_zone"] != "'Europe/Berlin'" {
+					t.Errorf("timezone = %v, %q", mc.Loc, mc.Params["time_zone"])
+				}
+			},
+		},
+		{
+			name:    "unknown timezone",
+			set:     func(c *config.SQLDatabase) { c.Timezone = "Mars/Olympus" },
+			wantErr: true,
+		},
+		{
+			name: "driver options in params",
+			set: func(c *config.SQLDatabase) {
+				c.ApplicationName = "gorbit"
+				c.Params = map[string]string{
+					"interpolateparams":    "true",
+					"readtimeout":          "30s",
+					"maxallowedpacket":     "1048576",
+					"connectionattributes": "team:billing",
+					"sql_mode":             "'TRADITIONAL'",
+				}
+			},
+			check: func(t *testing.T, mc *gomysql.Config) {
+				if !mc.InterpolateParams || mc.ReadTimeout != 30*time.Second || mc.MaxAllowedPacket != 1<<20 {
+					t.Errorf("driver options = %v, %v, %v", mc.InterpolateParams, mc.ReadTimeout, mc.MaxAllowedPacket)
+				}
+				if mc.ConnectionAttributes != "team:billing,program_name:gorbit" {
+					t.Errorf("ConnectionAttributes = %q", mc.ConnectionAttributes)
+				}
+				want := map[string]string{"charset": "utf8mb4", "time_zone": "'+00:00'", "sql_mode": "'TRADITIONAL'"}
+				if !reflect.DeepEqual(mc.Params, want) {
+					t.Errorf("Params = %v, want %v", mc.Params, want)
+				}
+			},
+		},
+		{
+			name:    "invalid driver option",
+			set:     func(c *config.SQLDatabase) { c.Params = map[string]string{"readtimeout": "soon"} },
+			wantErr: true,
+		},
+		{
+			name: "prefer",
+			set:  func(c *config.SQLDatabase) { c.SSLMode = "prefer" },
+			check: func(t *testing.T, mc *gomysql.Config) {
+				if mc.TLSConfig != "preferred" || mc.TLS == nil || !mc.AllowFallbackToPlaintext {
+					t.Errorf("TLS = %q, %v, fallback %v", mc.TLSConfig, mc.TLS, mc.AllowFallbackToPlaintext)
+				}
+			},
+		},
+		{
+			name: "require",
+			set:  func(c *config.SQLDatabase) { c.SSLMode = "require" },
+			check: func(t *testing.T, mc *gomysql.Config) {
+				if mc.TLSConfig != "gorbit:db.internal:3306" || mc.TLS == nil || !mc.TLS.InsecureSkipVerify {
+					t.Errorf("TLS = %q, %+v", mc.TLSConfig, mc.TLS)
+				}
+			},
+		},
+		{
+			name: "verify-full",
+			set:  func(c *config.SQLDatabase) { c.SSLMode = "verify-full" },
+			check: func(t *testing.T, mc *gomysql.Config) {
+				if mc.TLS == nil || mc.TLS.InsecureSkipVerify || mc.TLS.ServerName != "db.internal" || mc.TLS.RootCAs == nil {
+					t.Errorf("TLS = %+v", mc.TLS)
+				}
+			},
+		},
+		{
+			name:    "missing root certificate",
+			set:     func(c *config.SQLDatabase) { c.SSLMode = "verify-ca"; c.SSLRootCert = "testdata/missing.pem" },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mysqlTestConfig()
+			tt.set(&c)
+			mc, err := mysqlDSN(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("mysqlDSN() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mysqlDSN() error = %v", err)
+			}
+			tt.check(t, mc)
+		})
+	}
+}
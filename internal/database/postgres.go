@@ -2,31 +2,148 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorbit/internal/config"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func InitPostgres(cfg *config.Config) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Asia/Shanghai",
-		cfg.Databases.Postgres.Host,
-		cfg.Databases.Postgres.Username,
-		cfg.Databases.Postgres.Password,
-		cfg.Databases.Postgres.Database,
-		cfg.Databases.Postgres.Port,
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		// Add additional configurations if needed
+// PostgresDriver is the registry name of the PostgreSQL datastore.
+const PostgresDriver = "postgres"
+
+func init() {
+	Register(Driver{
+		Name:     PostgresDriver,
+		Order:    20,
+		Critical: true,
+		Enabled: func(cfg *config.Config) bool {
+			return cfg.Databases.Postgres.Enabled
+		},
+		Open: func(ctx context.Context, cfg *config.Config) (Store, error) {
+			db, err := InitPostgres(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+			return &SQLStore{DB: db}, nil
+		},
+		Retry: func(cfg *config.Config) config.RetryPolicy {
+			return cfg.Databases.Postgres.Retry
+		},
+		Retryable:       postgresRetryable,
+		CreateMigration: createSQLMigration,
 	})
+}
+
+// postgresRetryable reports serialization failures and deadlocks.
+func postgresRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
+
+func InitPostgres(ctx context.Context, cfg *config.Config) (*gorm.DB, error) {
+	c := cfg.Databases.Postgres
+	pgConfig, err := pgx.ParseConfig(postgresDSN(c))
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("postgres configuration: %w", err))
+	}
+	pool := stdlib.OpenDB(*pgConfig)
+	db, err := openSQL(ctx, PostgresDriver, pool, postgres.New(postgres.Config{Conn: pool}), c, NewQueryLogger(PostgresDriver, cfg.Databases.QueryLog))
 	if err != nil {
-		log.Printf("Failed to connect to Postgres: %v", err)
 		return nil, err
 	}
-
+	replica := func(c config.SQLDatabase) (gorm.Dialector, error) {
+		return postgres.Open(postgresDSN(c)), nil
+	}
+	if err := useReplicas(db, PostgresDriver, c, replica, postgresReplicaLag); err != nil {
+		closeSQL(db)
+		return nil, err
+	}
 	return db, nil
 }
+
+// postgresReplicaLag measures how long ago the last replayed transaction
+// was committed on the primary; a standby that has replayed everything it
+// received has no lag.
+func postgresReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := db.QueryRowContext(ctx, `SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN NULL
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+	END`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	if !seconds.Valid {
+		return 0, errors.New("not a streaming standby")
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+// postgresDSN builds a keyword/value connection string from c. The
+// statement timeout and extra params are sent as run-time parameters.
+func postgresDSN(c config.SQLDatabase) string {
+	params := [][2]string{
+		{"host", c.Host},
+		{"port", strconv.Itoa(c.Port)},
+		{"user", c.Username},
+		{"password", c.Password},
+		{"dbname", c.Database},
+		{"sslmode", sslMode(c)},
+		{"TimeZone", timezone(c)},
+	}
+	for _, p := range [][2]string{
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+		{"application_name", c.ApplicationName},
+	} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+	if c.ConnectTimeout > 0 {
+		// connect_timeout is in whole seconds
+		seconds := int64(math.Ceil(c.ConnectTimeout.Seconds()))
+		params = append(params, [2]string{"connect_timeout", strconv.FormatInt(seconds, 10)})
+	}
+	if c.StatementTimeout > 0 {
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)})
+	}
+	keys := make([]string, 0, len(c.Params))
+	for k := range c.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		params = append(params, [2]string{k, c.Params[k]})
+	}
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p[0] + "=" + quoteDSNValue(p[1])
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes empty values and values with spaces, quotes or
+// backslashes.
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
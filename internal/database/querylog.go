@@ -0,0 +1,470 @@
+// internal/database/querylog.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorbit/internal/config"
+	"gorbit/pkg/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	explainPluginName = "gorbit:explain"
+	explainStartName  = "gorbit:explain_start"
+	// explainTimeout bounds the EXPLAIN of a slow statement.
+	explainTimeout = 2 * time.Second
+	// maxExplains bounds the EXPLAINs running at once; the plans of slow
+	// statements beyond it are not logged
+	maxExplains = 2
+)
+
+// redactColumns are the column name fragments whose values are always
+// masked in logged statements.
+var redactColumns = []string{"password", "secret", "token", "api_key"}
+
+// QueryLogger is a GORM logger writing slog records. Statements are logged
+// at debug level, those slower than the slow threshold as warnings, and
+// failed ones as errors. Values bound to sensitive columns are masked.
+type QueryLogger struct {
+	store  string
+	cfg    config.QueryLog
+	redact []string
+	level  logger.LogLevel
+}
+
+// NewQueryLogger returns the logger of the named SQL store.
+func NewQueryLogger(store string, cfg config.QueryLog) *QueryLogger {
+	redact := append([]string(nil), redactColumns...)
+	for _, column := range cfg.RedactColumns {
+		redact = append(redact, strings.ToLower(column))
+	}
+	return &QueryLogger{store: store, cfg: cfg, redact: redact, level: logger.Info}
+}
+
+// LogMode returns a copy of l logging at level; GORM's db.Debug() uses
+// logger.Info.
+func (l *QueryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *QueryLogger) Info(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Info {
+		slog.Default().LogAttrs(ctx, slog.LevelInfo, fmt.Sprintf(msg, args...), l.attrs(ctx)...)
+	}
+}
+
+func (l *QueryLogger) Warn(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Warn {
+		slog.Default().LogAttrs(ctx, slog.LevelWarn, fmt.Sprintf(msg, args...), l.attrs(ctx)...)
+	}
+}
+
+func (l *QueryLogger) Error(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Error {
+		slog.Default().LogAttrs(ctx, slog.LevelError, fmt.Sprintf(msg, args...), l.attrs(ctx)...)
+	}
+}
+
+// Trace logs a statement once it has run. The SQL is only rendered when
+// the record is written.
+func (l *QueryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	slow := l.cfg.SlowThreshold > 0 && elapsed > l.cfg.SlowThreshold
+
+	var (
+		level slog.Level
+		msg   string
+	)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		level, msg = slog.LevelError, "SQL statement failed"
+	case slow && l.level >= logger.Warn:
+		level, msg = slog.LevelWarn, "Slow SQL statement"
+	case l.level >= logger.Info:
+		level, msg = slog.LevelDebug, "SQL statement"
+	default:
+		return
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	query, rows := fc()
+	attrs := append(l.attrs(ctx),
+		slog.String("sql", query),
+		slog.Int64("rows", rows),
+		slog.Duration("duration", elapsed),
+		slog.String("caller", caller()),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	slog.Default().LogAttrs(ctx, level, msg, attrs...)
+}
+
+// caller returns the file and line of the code that ran a statement: the
+// first frame outside GORM and this logger.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "gorm.io/") && !strings.Contains(frame.Function, "(*QueryLogger)") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func (l *QueryLogger) attrs(ctx context.Context) []slog.Attr {
+	attrs := []slog.Attr{slog.String("store", l.store)}
+	if id := utils.RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	return attrs
+}
+
+// explainer is a GORM plugin logging the query plan of slow statements.
+// The EXPLAIN runs in the background, on the SQL of the statement with its
+// values bound as parameters, so that it neither delays the request nor
+// depends on how values are rendered for the log.
+type explainer struct {
+	store     string
+	threshold time.Duration
+	db        *sql.DB
+	running   chan struct{}
+}
+
+// explainer returns the plugin explaining the slow statements of l with
+// db, or nil if explain is off.
+func (l *QueryLogger) explainer(db *sql.DB) gorm.Plugin {
+	if !l.cfg.Explain || l.cfg.SlowThreshold <= 0 {
+		return nil
+	}
+	return &explainer{
+		store:     l.store,
+		threshold: l.cfg.SlowThreshold,
+		db:        db,
+		running:   make(chan struct{}, maxExplains),
+	}
+}
+
+func (e *explainer) Name() string {
+	return explainPluginName
+}
+
+func (e *explainer) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register(explainStartName, e.start),
+		callbacks.Query().Before("*").Register(explainStartName, e.start),
+		callbacks.Update().Before("*").Register(explainStartName, e.start),
+		callbacks.Delete().Before("*").Register(explainStartName, e.start),
+		callbacks.Row().Before("*").Register(explainStartName, e.start),
+		callbacks.Raw().Before("*").Register(explainStartName, e.start),
+		callbacks.Create().After("*").Register(explainPluginName, e.finish),
+		callbacks.Query().After("*").Register(explainPluginName, e.finish),
+		callbacks.Update().After("*").Register(explainPluginName, e.finish),
+		callbacks.Delete().After("*").Register(explainPluginName, e.finish),
+		callbacks.Row().After("*").Register(explainPluginName, e.finish),
+		callbacks.Raw().After("*").Register(explainPluginName, e.finish),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *explainer) start(db *gorm.DB) {
+	db.InstanceSet(explainStartName, time.Now())
+}
+
+// finish starts the EXPLAIN of a statement that succeeded but was slow,
+// unless maxExplains are running already.
+func (e *explainer) finish(db *gorm.DB) {
+	stmt := db.Statement
+	start, ok := db.InstanceGet(explainStartName)
+	if !ok || db.Error != nil || stmt.SQL.Len() == 0 || time.Since(start.(time.Time)) <= e.threshold {
+		return
+	}
+	query := stmt.SQL.String()
+	vars := append([]any(nil), stmt.Vars...)
+	ctx := stmt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	select {
+	case e.running <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-e.running }()
+		plan, err := e.explain(ctx, query, vars)
+		if err == nil && plan == "" {
+			return
+		}
+		attrs := []slog.Attr{slog.String("store", e.store)}
+		if id := utils.RequestID(ctx); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		attrs = append(attrs, slog.String("sql", query))
+		if err != nil {
+			attrs = append(attrs, slog.String("plan_error", err.Error()))
+		} else {
+			attrs = append(attrs, slog.String("plan", plan))
+		}
+		slog.Default().LogAttrs(ctx, slog.LevelWarn, "Slow SQL statement plan", attrs...)
+	}()
+}
+
+// explain returns the plan of a single SELECT, INSERT, UPDATE or DELETE
+// statement, one line per row of the EXPLAIN output. Other statements are
+// not explained.
+func (e *explainer) explain(ctx context.Context, query string, vars []any) (string, error) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	first, _, _ := strings.Cut(query, " ")
+	switch strings.ToLower(first) {
+	case "select", "insert", "update", "delete", "with":
+	default:
+		return "", nil
+	}
+	if strings.Contains(query, ";") {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, explainTimeout)
+	defer cancel()
+	rows, err := e.db.QueryContext(ctx, "EXPLAIN "+query, vars...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var lines []string
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return "", err
+		}
+		// PostgreSQL returns the plan as text, MySQL as a table
+		if len(columns) == 1 {
+			lines = append(lines, values[0].String)
+			continue
+		}
+		var fields []string
+		for i, column := range columns {
+			if values[i].Valid {
+				fields = append(fields, column+"="+values[i].String)
+			}
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+// ParamsFilter masks the values bound to sensitive columns before GORM
+// renders a statement for the log.
+func (l *QueryLogger) ParamsFilter(ctx context.Context, query string, params ...any) (string, []any) {
+	columns := paramColumns(query)
+	var filtered []any
+	for i, column := range columns {
+		if i >= len(params) || !l.sensitive(column) {
+			continue
+		}
+		if filtered == nil {
+			filtered = append([]any(nil), params...)
+		}
+		filtered[i] = config.RedactedValue
+	}
+	if filtered == nil {
+		return query, params
+	}
+	return query, filtered
+}
+
+func (l *QueryLogger) sensitive(column string) bool {
+	if column == "" {
+		return false
+	}
+	for _, s := range l.redact {
+		if strings.Contains(column, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlKeywords are the words that are not column names when looking for the
+// column a placeholder binds to.
+var sqlKeywords = map[string]bool{
+	"all": true, "and": true, "any": true, "as": true, "asc": true, "between": true,
+	"by": true, "case": true, "delete": true, "desc": true, "distinct": true,
+	"else": true, "end": true, "exists": true, "false": true, "from": true,
+	"group": true, "having": true, "ilike": true, "in": true, "inner": true,
+	"insert": true, "into": true, "is": true, "join": true, "left": true,
+	"like": true, "limit": true, "not": true, "null": true, "offset": true,
+	"on": true, "or": true, "order": true, "outer": true, "replace": true,
+	"returning": true, "right": true, "select": true, "set": true, "then": true,
+	"true": true, "update": true, "values": true, "when": true, "where": true,
+}
+
+// paramColumns returns the lower-cased column each placeholder (? or $n)
+// of query binds to, as far as it can be told: its position in the column
+// list of an INSERT, otherwise the closest column before it. Unknown
+// columns are "".
+func paramColumns(query string) []string {
+	var (
+		columns    []string
+		insertCols []string
+		last       string
+		isInsert   bool
+		inColumns  bool
+		inValues   bool
+		depth, pos int
+		words      int
+	)
+	add := func(index int, column string) {
+		for len(columns) <= index {
+			columns = append(columns, "")
+		}
+		columns[index] = column
+	}
+	placeholder := func(index int) {
+		if inValues && depth > 0 {
+			if pos < len(insertCols) {
+				add(index, insertCols[pos])
+			} else {
+				add(index, "")
+			}
+			return
+		}
+		add(index, last)
+	}
+
+	next := 0
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			// String literal, with '' or \' escapes
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+				} else if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+		case ch == '`' || ch == '"':
+			end := strings.IndexByte(query[i+1:], ch)
+			if end < 0 {
+				return columns
+			}
+			ident := strings.ToLower(query[i+1 : i+1+end])
+			i += end + 2
+			if inColumns {
+				insertCols = append(insertCols, ident)
+			}
+			last = ident
+		case ch == '?':
+			placeholder(next)
+			next++
+			i++
+		case ch == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			if n > 0 {
+				placeholder(n - 1)
+			}
+			i = j
+		case ch == '(':
+			if inValues {
+				depth++
+				if depth == 1 {
+					pos = 0
+				}
+			} else if isInsert && insertCols == nil && !inColumns {
+				inColumns = true
+			}
+			i++
+		case ch == ')':
+			if inValues && depth > 0 {
+				depth--
+			}
+			inColumns = false
+			i++
+		case ch == ',':
+			if inValues && depth == 1 {
+				pos++
+			}
+			i++
+		case ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z':
+			j := i
+			for j < len(query) && (query[j] == '_' || query[j] >= 'a' && query[j] <= 'z' ||
+				query[j] >= 'A' && query[j] <= 'Z' || query[j] >= '0' && query[j] <= '9') {
+				j++
+			}
+			word := strings.ToLower(query[i:j])
+			i = j
+			words++
+			if words == 1 && (word == "insert" || word == "replace") {
+				isInsert = true
+			}
+			if inValues && depth == 0 && word != "values" {
+				inValues = false
+			}
+			switch {
+			case word == "values" && isInsert:
+				inValues, inColumns = true, false
+			case word == "limit" || word == "offset":
+				last = ""
+			case !sqlKeywords[word]:
+				if inColumns {
+					insertCols = append(insertCols, word)
+				}
+				last = word
+			}
+		default:
+			i++
+		}
+	}
+	return columns
+}
@@ -0,0 +1,134 @@
+// internal/database/querylog_test.go
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"gorbit/internal/config"
+)
+
+func TestParamColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "mysql insert",
+			query: "INSERT INTO `users` (`name`,`password`,`created_at`) VALUES (?,?,?)",
+			want:  []string{"name", "password", "created_at"},
+		},
+		{
+			name:  "multi-row insert",
+			query: "INSERT INTO `users` (`name`,`token`) VALUES (?,?),(?,?)",
+			want:  []string{"name", "token", "name", "token"},
+		},
+		{
+			name:  "postgres insert",
+			query: `INSERT INTO "users" ("email","password_hash") VALUES ($1,$2) RETURNING "id"`,
+			want:  []string{"email", "password_hash"},
+		},
+		{
+			name:  "insert with function values",
+			query: "INSERT INTO t (a, b, secret) VALUES (?, NOW(), ?)",
+			want:  []string{"a", "secret"},
+		},
+		{
+			name:  "insert without column list",
+			query: "INSERT INTO t VALUES (?, ?)",
+			want:  []string{"", ""},
+		},
+		{
+			name:  "upsert",
+			query: `INSERT INTO "users" ("id","api_key") VALUES ($1,$2) ON CONFLICT ("id") DO UPDATE SET "api_key" = $3`,
+			want:  []string{"id", "api_key", "api_key"},
+		},
+		{
+			name:  "update",
+			query: "UPDATE `users` SET `password`=?,`updated_at`=? WHERE `id` = ?",
+			want:  []string{"password", "updated_at", "id"},
+		},
+		{
+			name:  "select with in and limit",
+			query: "SELECT * FROM users WHERE api_key = ? AND role IN (?,?) LIMIT ? OFFSET ?",
+			want:  []string{"api_key", "role", "role", "", ""},
+		},
+		{
+			name:  "comparison operators",
+			query: `SELECT * FROM "sessions" WHERE "token" <> $1 AND expires_at >= $2`,
+			want:  []string{"token", "expires_at"},
+		},
+		{
+			name:  "placeholders in string literals",
+			query: "SELECT * FROM t WHERE note = 'what? it''s $1' AND secret = ?",
+			want:  []string{"secret"},
+		},
+		{
+			name:  "postgres parameters out of order",
+			query: `UPDATE "users" SET "password" = $2 WHERE "id" = $1`,
+			want:  []string{"id", "password"},
+		},
+		{
+			name:  "no placeholders",
+			query: "SELECT 1",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paramColumns(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paramColumns() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamsFilter(t *testing.T) {
+	l := NewQueryLogger("test", config.QueryLog{RedactColumns: []string{"SSN"}})
+
+	tests := []struct {
+		name   string
+		query  string
+		params []any
+		want   []any
+	}{
+		{
+			name:   "sensitive columns",
+			query:  "INSERT INTO `users` (`email`,`password`,`user_ssn`) VALUES (?,?,?)",
+			params: []any{"ada@example.com", "hunter2", "078-05-1120"},
+			want:   []any{"ada@example.com", config.RedactedValue, config.RedactedValue},
+		},
+		{
+			name:   "column name fragment",
+			query:  "UPDATE `clients` SET `refresh_token_hash`=? WHERE `id` = ?",
+			params: []any{"abc", 7},
+			want:   []any{config.RedactedValue, 7},
+		},
+		{
+			name:   "nothing sensitive",
+			query:  "SELECT * FROM `users` WHERE `email` = ? LIMIT ?",
+			params: []any{"ada@example.com", 1},
+			want:   []any{"ada@example.com", 1},
+		},
+		{
+			name:   "fewer params than placeholders",
+			query:  "SELECT * FROM t WHERE a = ? AND password = ?",
+			params: []any{1},
+			want:   []any{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := append([]any(nil), tt.params...)
+			_, got := l.ParamsFilter(context.Background(), tt.query, params...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParamsFilter() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("ParamsFilter() modified the statement params: %v", params)
+			}
+		})
+	}
+}
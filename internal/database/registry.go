@@ -0,0 +1,157 @@
+// internal/database/registry.go
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"gorbit/internal/config"
+)
+
+// Store is an initialized connection to a backing store.
+type Store interface {
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// Driver describes a backing store that can be switched on from configuration.
+type Driver struct {
+	// Name identifies the store in logs and health reports.
+	Name string
+	// Order controls initialization order; stores are closed in reverse.
+	Order int
+	// Critical stores must be reachable for the service to be ready.
+	Critical bool
+	// Enabled reports whether the store is turned on in the configuration.
+	Enabled func(cfg *config.Config) bool
+	// Open connects to the store; ctx bounds the attempt.
+	Open func(ctx context.Context, cfg *config.Config) (Store, error)
+	// Retry returns the policy for retrying Open; nil connects once.
+	Retry func(cfg *config.Config) config.RetryPolicy
+	// Retryable reports whether err is a serialization failure or deadlock
+	// of the store, see IsRetryable; nil if it has no transactions.
+	Retryable func(err error) bool
+	// CreateMigration writes an empty migration for the store into dir and
+	// returns the created files; nil if the store has no migrations.
+	CreateMigration func(dir, name string) ([]string, error)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// Register makes a datastore driver available to Open. It panics if a driver
+// with the same name is registered twice.
+func Register(d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if d.Name == "" || d.Enabled == nil || d.Open == nil {
+		panic("database: Register called with incomplete driver")
+	}
+	if _, dup := drivers[d.Name]; dup {
+		panic("database: Register called twice for driver " + d.Name)
+	}
+	drivers[d.Name] = d
+}
+
+// Drivers returns the registered drivers in initialization order.
+func Drivers() []Driver {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	list := make([]Driver, 0, len(drivers))
+	for _, d := range drivers {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Order != list[j].Order {
+			return list[i].Order < list[j].Order
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Connect opens the store, retrying failed attempts as configured by the
+// driver's retry policy.
+func (d Driver) Connect(ctx context.Context, cfg *config.Config) (Store, error) {
+	var policy config.RetryPolicy
+	if d.Retry != nil {
+		policy = d.Retry(cfg)
+	}
+	return Retry(ctx, d.Name, policy, func(ctx context.Context) (Store, error) {
+		return d.Open(ctx, cfg)
+	})
+}
+
+// NamedStore pairs an opened store with the driver that opened it.
+type NamedStore struct {
+	Name     string
+	Critical bool
+	Store    Store
+}
+
+// Registry holds the stores opened for the enabled drivers.
+type Registry struct {
+	stores []NamedStore
+}
+
+// Open initializes every enabled datastore in driver order, retrying each
+// as configured. If one of them fails, the stores opened so far are closed
+// again before returning.
+func Open(cfg *config.Config) (*Registry, error) {
+	r := &Registry{}
+
+	for _, d := range Drivers() {
+		if !d.Enabled(cfg) {
+			slog.Debug("Datastore disabled", "store", d.Name)
+			continue
+		}
+
+		slog.Info("Initializing datastore", "store", d.Name)
+		store, err := d.Connect(context.Background(), cfg)
+		if err != nil {
+			if closeErr := r.Close(context.Background()); closeErr != nil {
+				slog.Warn("Failed to close datastores", "error", closeErr)
+			}
+			return nil, fmt.Errorf("%s initialization failed: %w", d.Name, err)
+		}
+		r.stores = append(r.stores, NamedStore{Name: d.Name, Critical: d.Critical, Store: store})
+	}
+
+	return r, nil
+}
+
+// Stores returns the opened stores in initialization order.
+func (r *Registry) Stores() []NamedStore {
+	return append([]NamedStore(nil), r.stores...)
+}
+
+// Get returns the store opened for the named driver.
+func (r *Registry) Get(name string) (Store, bool) {
+	for _, s := range r.stores {
+		if s.Name == name {
+			return s.Store, true
+		}
+	}
+	return nil, false
+}
+
+// Close closes all opened stores in reverse initialization order.
+func (r *Registry) Close(ctx context.Context) error {
+	var errs []error
+	for i := len(r.stores) - 1; i >= 0; i-- {
+		s := r.stores[i]
+		if err := s.Store.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+		}
+	}
+	r.stores = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,418 @@
+// internal/database/replicas.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorbit/internal/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	replicasPluginName  = "gorbit:replicas"
+	replicasRestoreName = "gorbit:replicas_restore"
+	// defaultReplicaCheckInterval is used when replica_check_interval is
+	// not set.
+	defaultReplicaCheckInterval = 5 * time.Second
+)
+
+// ReplicaStatus is the result of the latest health check of a read replica.
+type ReplicaStatus struct {
+	Addr    string
+	Healthy bool
+	Latency time.Duration
+	// Lag is only measured when max_replica_lag is set
+	Lag       time.Duration
+	Err       error
+	CheckedAt time.Time
+}
+
+type primaryKey struct{}
+
+// WithPrimary sends the reads made with the returned context to the
+// primary, e.g. to read back a row right after writing it.
+func WithPrimary(ctx context.Context) context.Context {
+	primary := &atomic.Bool{}
+	primary.Store(true)
+	return context.WithValue(ctx, primaryKey{}, primary)
+}
+
+// WithReadYourWrites sends the reads made with the returned context to the
+// primary once a write has been made with it, so that a request sees its
+// own writes whatever the replication lag.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(primaryKey{}).(*atomic.Bool); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, primaryKey{}, &atomic.Bool{})
+}
+
+func usePrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	primary, ok := ctx.Value(primaryKey{}).(*atomic.Bool)
+	return ok && primary.Load()
+}
+
+type replica struct {
+	addr string
+	db   *sql.DB
+
+	mu     sync.RWMutex
+	status ReplicaStatus
+}
+
+func (r *replica) Status() ReplicaStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// replicaSet is a GORM plugin sending the reads of a SQL store to its
+// replicas. Writes, transactions and connections pinned with
+// db.Connection stay on the primary, as do reads when every replica fails
+// its health check.
+type replicaSet struct {
+	name         string
+	primary      gorm.ConnPool
+	replicas     []*replica
+	leastLatency bool
+	maxLag       time.Duration
+	timeout      time.Duration
+	lag          func(ctx context.Context, db *sql.DB) (time.Duration, error)
+	next         atomic.Uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// useReplicas opens the replicas of c with the dialectors built by open and
+// routes the reads of db to them. The replication lag of a replica is
+// measured with lag.
+func useReplicas(db *gorm.DB, name string, c config.SQLDatabase, open func(c config.SQLDatabase) (gorm.Dialector, error), lag func(ctx context.Context, db *sql.DB) (time.Duration, error)) error {
+	if len(c.Replicas) == 0 {
+		return nil
+	}
+
+	s := &replicaSet{
+		name:         name,
+		leastLatency: c.ReplicaPolicy == "least_latency",
+		maxLag:       c.MaxReplicaLag,
+		timeout:      connectTimeout(c),
+		lag:          lag,
+	}
+	for _, addr := range c.Replicas {
+		rc, err := replicaConfig(c, addr)
+		if err != nil {
+			s.close()
+			return Permanent(fmt.Errorf("%s replica %q: %w", name, addr, err))
+		}
+		addr = net.JoinHostPort(rc.Host, strconv.Itoa(rc.Port))
+		dialector, err := open(rc)
+		if err != nil {
+			s.close()
+			return Permanent(fmt.Errorf("%s replica %s: %w", name, addr, err))
+		}
+
+		// Replicas are connected lazily so that one being down does not
+		// prevent startup; the health checks take it out of rotation
+		replicaDB, err := gorm.Open(dialector, &gorm.Config{Logger: db.Logger, DisableAutomaticPing: true})
+		if err == nil {
+			var sqlDB *sql.DB
+			if sqlDB, err = replicaDB.DB(); err == nil {
+				setPool(sqlDB, rc)
+				s.replicas = append(s.replicas, &replica{addr: addr, db: sqlDB})
+			}
+		}
+		if err != nil {
+			s.close()
+			return fmt.Errorf("%s replica %s: %w", name, addr, err)
+		}
+	}
+	if err := db.Use(s); err != nil {
+		s.close()
+		return err
+	}
+
+	interval := c.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	s.start(interval)
+
+	healthy := 0
+	for _, r := range s.replicas {
+		if r.Status().Healthy {
+			healthy++
+		}
+	}
+	policy := c.ReplicaPolicy
+	if policy == "" {
+		policy = "round_robin"
+	}
+	slog.Info("Read replicas enabled",
+		"store", name,
+		"replicas", len(s.replicas),
+		"healthy", healthy,
+		"policy", policy,
+	)
+	return nil
+}
+
+// replicaConfig returns c with the host and port of addr; the port of c is
+// kept when addr has none.
+func replicaConfig(c config.SQLDatabase, addr string) (config.SQLDatabase, error) {
+	host, port := addr, c.Port
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return c, fmt.Errorf("invalid port %q", p)
+		}
+		host, port = h, n
+	}
+	if host == "" {
+		return c, errors.New("missing host")
+	}
+	c.Host, c.Port = host, port
+	c.Replicas = nil
+	return c, nil
+}
+
+func replicasOf(db *gorm.DB) *replicaSet {
+	s, _ := db.Config.Plugins[replicasPluginName].(*replicaSet)
+	return s
+}
+
+func (s *replicaSet) Name() string {
+	return replicasPluginName
+}
+
+func (s *replicaSet) Initialize(db *gorm.DB) error {
+	s.primary = db.ConnPool
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Query().Before("*").Register(replicasPluginName, s.route),
+		callbacks.Row().Before("*").Register(replicasPluginName, s.route),
+		callbacks.Raw().Before("*").Register(replicasPluginName, s.route),
+		callbacks.Query().After("*").Register(replicasRestoreName, s.restore),
+		callbacks.Row().After("*").Register(replicasRestoreName, s.restore),
+		callbacks.Raw().After("*").Register(replicasRestoreName, s.restore),
+		callbacks.Create().Before("*").Register(replicasRestoreName, s.restore),
+		callbacks.Update().Before("*").Register(replicasRestoreName, s.restore),
+		callbacks.Delete().Before("*").Register(replicasRestoreName, s.restore),
+		callbacks.Create().After("*").Register(replicasPluginName, s.wrote),
+		callbacks.Update().After("*").Register(replicasPluginName, s.wrote),
+		callbacks.Delete().After("*").Register(replicasPluginName, s.wrote),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// route sends a read to a replica. Raw SQL counts as a read when it is a
+// SELECT without a locking clause.
+func (s *replicaSet) route(db *gorm.DB) {
+	stmt := db.Statement
+	if s.isReplica(stmt.ConnPool) {
+		// A chain reused after a read; pick again
+		stmt.ConnPool = s.primary
+	} else if stmt.ConnPool != s.primary {
+		// A transaction or a pinned connection
+		return
+	}
+	if raw := stmt.SQL.String(); raw != "" {
+		if !isPlainSelect(raw) {
+			s.wrote(db)
+			return
+		}
+	} else if _, locking := stmt.Clauses["FOR"]; locking {
+		return
+	}
+	if usePrimary(stmt.Context) {
+		return
+	}
+	if r := s.pick(); r != nil {
+		stmt.ConnPool = r.db
+	}
+}
+
+// restore puts a statement routed to a replica back on the primary. GORM
+// reuses the statement of a chain, e.g. db.Where(...) followed by First and
+// Update, so a write or a Begin on it would otherwise go to the replica.
+func (s *replicaSet) restore(db *gorm.DB) {
+	if s.isReplica(db.Statement.ConnPool) {
+		db.Statement.ConnPool = s.primary
+	}
+}
+
+func (s *replicaSet) isReplica(pool gorm.ConnPool) bool {
+	for _, r := range s.replicas {
+		if pool == r.db {
+			return true
+		}
+	}
+	return false
+}
+
+// wrote marks the context of a write for WithReadYourWrites.
+func (s *replicaSet) wrote(db *gorm.DB) {
+	if db.Statement.Context == nil {
+		return
+	}
+	if primary, ok := db.Statement.Context.Value(primaryKey{}).(*atomic.Bool); ok {
+		primary.Store(true)
+	}
+}
+
+func isPlainSelect(query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	return strings.HasPrefix(query, "select") &&
+		!strings.Contains(query, " for update") &&
+		!strings.Contains(query, " for share") &&
+		!strings.Contains(query, " lock in share mode")
+}
+
+// pick returns the next healthy replica, or nil if there is none.
+func (s *replicaSet) pick() *replica {
+	if s.leastLatency {
+		var (
+			best    *replica
+			latency time.Duration
+		)
+		for _, r := range s.replicas {
+			if status := r.Status(); status.Healthy && (best == nil || status.Latency < latency) {
+				best, latency = r, status.Latency
+			}
+		}
+		return best
+	}
+
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := s.replicas[(start+i)%n]; r.Status().Healthy {
+			return r
+		}
+	}
+	return nil
+}
+
+// start checks the replicas once, then every interval in the background.
+func (s *replicaSet) start(interval time.Duration) {
+	s.checkAll()
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.checkAll()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *replicaSet) checkAll() {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			s.check(r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// check pings r and, with max_replica_lag set, measures its lag. Changes
+// in its health are logged.
+func (s *replicaSet) check(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := r.db.PingContext(ctx)
+	status := ReplicaStatus{Addr: r.addr, Latency: time.Since(start), CheckedAt: start.UTC()}
+	if err == nil && s.maxLag > 0 {
+		status.Lag, err = s.lag(ctx, r.db)
+		if err == nil && status.Lag > s.maxLag {
+			err = fmt.Errorf("replication lag %s exceeds %s", status.Lag, s.maxLag)
+		}
+	}
+	status.Healthy = err == nil
+	status.Err = err
+
+	r.mu.Lock()
+	prev := r.status
+	r.status = status
+	r.mu.Unlock()
+
+	switch {
+	case !status.Healthy && (prev.Healthy || prev.CheckedAt.IsZero()):
+		slog.Warn("Read replica out of rotation", "store", s.name, "replica", r.addr, "error", err)
+	case status.Healthy && !prev.Healthy && !prev.CheckedAt.IsZero():
+		slog.Info("Read replica back in rotation", "store", s.name, "replica", r.addr)
+	}
+}
+
+// close stops the health checks and closes the replica pools.
+func (s *replicaSet) close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	var errs []error
+	for _, r := range s.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("replica %s: %w", r.addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Replicas returns the status of the read replicas of s, if it has any.
+func (s *SQLStore) Replicas() []ReplicaStatus {
+	rs := replicasOf(s.DB)
+	if rs == nil {
+		return nil
+	}
+	statuses := make([]ReplicaStatus, len(rs.replicas))
+	for i, r := range rs.replicas {
+		statuses[i] = r.Status()
+	}
+	return statuses
+}
+
+// CheckReplica reports why the replica at addr is out of rotation, as
+// found by its latest health check; nil if it is serving reads.
+func (s *SQLStore) CheckReplica(addr string) error {
+	for _, status := range s.Replicas() {
+		if status.Addr == addr {
+			return status.Err
+		}
+	}
+	return fmt.Errorf("unknown replica %s", addr)
+}
@@ -0,0 +1,485 @@
+// internal/database/repository.go
+package database
+
+import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultListLimit is the page size when ListOptions.Limit is not set.
+	DefaultListLimit = 20
+	// MaxListLimit is the largest page size ParseListQuery accepts.
+	MaxListLimit = 100
+)
+
+var (
+	// ErrNotFound is returned when no record has the requested ID.
+	ErrNotFound = errors.New("record not found")
+	// ErrInvalidQuery is wrapped by the errors of List when its options
+	// name an unknown field, have a value of the wrong type or a cursor
+	// that does not match them.
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// Repository stores records of type T, whatever the backing store.
+// Records are identified by the string form of their primary key.
+type Repository[T any] interface {
+	Create(ctx context.Context, record *T) error
+	Get(ctx context.Context, id string) (*T, error)
+	Update(ctx context.Context, record *T) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, opts ListOptions) (Page[T], error)
+}
+
+// Op is the comparison of a Filter.
+type Op string
+
+const (
+	OpEq       Op = "eq"
+	OpNe       Op = "ne"
+	OpGt       Op = "gt"
+	OpGte      Op = "gte"
+	OpLt       Op = "lt"
+	OpLte      Op = "lte"
+	OpIn       Op = "in"
+	OpContains Op = "contains"
+	// OpNull matches null fields if its value is true, others if false.
+	OpNull Op = "null"
+)
+
+var ops = map[Op]bool{
+	OpEq: true, OpNe: true, OpGt: true, OpGte: true, OpLt: true,
+	OpLte: true, OpIn: true, OpContains: true, OpNull: true,
+}
+
+// Filter compares a field with a value. Field is the column or BSON key,
+// "id" always naming the primary key. The value is converted to the type
+// of the field; strings are parsed, so filters can be taken from a query
+// string as they are.
+type Filter struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+func Eq(field string, value any) Filter  { return Filter{field, OpEq, value} }
+func Ne(field string, value any) Filter  { return Filter{field, OpNe, value} }
+func Gt(field string, value any) Filter  { return Filter{field, OpGt, value} }
+func Gte(field string, value any) Filter { return Filter{field, OpGte, value} }
+func Lt(field string, value any) Filter  { return Filter{field, OpLt, value} }
+func Lte(field string, value any) Filter { return Filter{field, OpLte, value} }
+
+// In matches fields equal to one of values.
+func In(field string, values ...any) Filter { return Filter{field, OpIn, values} }
+
+// Contains matches string fields containing s. Case sensitivity follows
+// the collation of the store.
+func Contains(field, s string) Filter { return Filter{field, OpContains, s} }
+
+// IsNull matches fields that are null, or not if null is false.
+func IsNull(field string, null bool) Filter { return Filter{field, OpNull, null} }
+
+// Sort orders a list by a field.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ListOptions select a page of records. Records are ordered by Sort, then
+// by primary key.
+//
+// Pages are read after Cursor, the NextCursor of the previous page, or
+// after skipping Offset records; the two cannot be combined. The filters
+// and sort of the following pages must be those of the first. No cursor is
+// returned when sorting by a field that can be null; use Offset then.
+type ListOptions struct {
+	Filters []Filter
+	Sort    []Sort
+	// Limit defaults to DefaultListLimit
+	Limit  int
+	Offset int
+	Cursor string
+	// Total counts the records matching the filters
+	Total bool
+}
+
+// Page is a page of records.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// ParseListQuery reads list options from query parameters:
+//
+//	limit=20&offset=40&cursor=...&sort=-created_at,name&total=true
+//	name=widget&price[gte]=10&status[in]=new,paid&deleted_at[null]=true
+//
+// Every other parameter is a filter named field or field[op]. The limit is
+// capped at MaxListLimit. Field names and values are checked by List.
+func ParseListQuery(query map[string]string) (ListOptions, error) {
+	opts := ListOptions{Limit: DefaultListLimit}
+	for key, value := range query {
+		var err error
+		switch key {
+		case "limit":
+			opts.Limit, err = strconv.Atoi(value)
+			if err == nil && opts.Limit < 1 {
+				err = errors.New("must be positive")
+			}
+			opts.Limit = min(opts.Limit, MaxListLimit)
+		case "offset":
+			opts.Offset, err = strconv.Atoi(value)
+			if err == nil && opts.Offset < 0 {
+				err = errors.New("must not be negative")
+			}
+		case "cursor":
+			opts.Cursor = value
+		case "total":
+			opts.Total, err = strconv.ParseBool(value)
+		case "sort":
+			for _, field := range strings.Split(value, ",") {
+				field = strings.TrimSpace(field)
+				desc := strings.HasPrefix(field, "-")
+				field = strings.TrimPrefix(field, "-")
+				if field == "" {
+					err = errors.New("empty field")
+					break
+				}
+				opts.Sort = append(opts.Sort, Sort{Field: field, Desc: desc})
+			}
+		default:
+			field, op := key, OpEq
+			if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+				field, op = key[:i], Op(key[i+1:len(key)-1])
+			}
+			if !ops[op] {
+				err = fmt.Errorf("unknown operator %q", op)
+				break
+			}
+			var v any = value
+			if op == OpIn {
+				v = strings.Split(value, ",")
+			}
+			opts.Filters = append(opts.Filters, Filter{Field: field, Op: op, Value: v})
+		}
+		if err != nil {
+			return opts, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, key, err)
+		}
+	}
+	return opts, nil
+}
+
+// modelField is a field of a stored type that can be filtered and sorted.
+type modelField struct {
+	name     string
+	typ      reflect.Type // without the pointer of nullable fields
+	nullable bool
+	value    func(record reflect.Value) any
+}
+
+// model describes the fields of a stored type to the shared list code.
+type model struct {
+	fields map[string]*modelField
+	key    *modelField
+}
+
+func (m *model) field(name string) (*modelField, error) {
+	if f, ok := m.fields[name]; ok {
+		return f, nil
+	}
+	if name == "id" {
+		return m.key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, name)
+}
+
+// parseKey converts id to the type of the primary key.
+func (m *model) parseKey(id string) (any, error) {
+	return convert(id, m.key.typ)
+}
+
+// condition is a checked filter, its value converted for the store.
+type condition struct {
+	field *modelField
+	op    Op
+	value any
+}
+
+type sortKey struct {
+	field *modelField
+	desc  bool
+}
+
+// listPlan is ListOptions checked against a model.
+type listPlan struct {
+	conditions []condition
+	sort       []sortKey
+	// after holds the sort values of the last record of the previous page
+	after  []any
+	limit  int
+	offset int
+	total  bool
+}
+
+func (m *model) plan(opts ListOptions) (*listPlan, error) {
+	if opts.Cursor != "" && opts.Offset > 0 {
+		return nil, fmt.Errorf("%w: cursor and offset cannot be combined", ErrInvalidQuery)
+	}
+	p := &listPlan{limit: opts.Limit, offset: max(opts.Offset, 0), total: opts.Total}
+	if p.limit <= 0 {
+		p.limit = DefaultListLimit
+	}
+
+	for _, f := range opts.Filters {
+		field, err := m.field(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		c := condition{field: field, op: f.Op}
+		switch f.Op {
+		case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte:
+			c.value, err = convert(f.Value, field.typ)
+		case OpIn:
+			c.value, err = convertAll(f.Value, field.typ)
+		case OpContains:
+			if field.typ.Kind() != reflect.String {
+				err = errors.New("not a string field")
+			} else {
+				c.value, err = convert(f.Value, reflect.TypeOf(""))
+			}
+		case OpNull:
+			c.value, err = convert(f.Value, reflect.TypeOf(true))
+		default:
+			err = fmt.Errorf("unknown operator %q", f.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, f.Field, err)
+		}
+		p.conditions = append(p.conditions, c)
+	}
+
+	seen := make(map[*modelField]bool)
+	for _, s := range opts.Sort {
+		field, err := m.field(s.Field)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[field] {
+			seen[field] = true
+			p.sort = append(p.sort, sortKey{field: field, desc: s.Desc})
+		}
+	}
+	if !seen[m.key] {
+		p.sort = append(p.sort, sortKey{field: m.key})
+	}
+
+	if opts.Cursor != "" {
+		after, err := p.decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cursor: %v", ErrInvalidQuery, err)
+		}
+		p.after = after
+	}
+	return p, nil
+}
+
+// keyset reports whether the plan can be paged with cursors.
+func (p *listPlan) keyset() bool {
+	for _, s := range p.sort {
+		if s.field.nullable {
+			return false
+		}
+	}
+	return true
+}
+
+// cursor is the JSON form of a cursor: the sort it was made for and the
+// sort values of the record it points at.
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func (p *listPlan) sortSpec() string {
+	parts := make([]string, len(p.sort))
+	for i, s := range p.sort {
+		parts[i] = s.field.name
+		if s.desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *listPlan) encodeCursor(record reflect.Value) (string, error) {
+	c := cursor{Sort: p.sortSpec()}
+	for _, s := range p.sort {
+		data, err := json.Marshal(s.field.value(record))
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, data)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (p *listPlan) decodeCursor(s string) ([]any, error) {
+	if !p.keyset() {
+		return nil, errors.New("not supported when sorting by a nullable field")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed")
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.New("malformed")
+	}
+	if c.Sort != p.sortSpec() || len(c.Values) != len(p.sort) {
+		return nil, errors.New("does not match the sort")
+	}
+
+	values := make([]any, len(c.Values))
+	for i, raw := range c.Values {
+		v := reflect.New(p.sort[i].field.typ)
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, errors.New("malformed")
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+// newPage trims the extra record read to tell whether there are more and
+// sets the cursor of the next page.
+func newPage[T any](p *listPlan, items []T, total *int64) (Page[T], error) {
+	page := Page[T]{Items: items, Total: total}
+	if len(items) <= p.limit {
+		return page, nil
+	}
+	page.Items, page.HasMore = items[:p.limit], true
+	if p.offset == 0 && p.keyset() {
+		next, err := p.encodeCursor(reflect.ValueOf(&page.Items[p.limit-1]).Elem())
+		if err != nil {
+			return page, err
+		}
+		page.NextCursor = next
+	}
+	return page, nil
+}
+
+// keysetTerm is one alternative of the condition selecting the records
+// after a cursor: the equal sort fields before it, then the compared one.
+type keysetTerm struct {
+	equal []condition
+	after condition
+}
+
+// keysetTerms expands (a, b) > (x, y), with per field directions, into
+// a > x OR (a = x AND b > y).
+func (p *listPlan) keysetTerms() []keysetTerm {
+	terms := make([]keysetTerm, len(p.sort))
+	for i, s := range p.sort {
+		for j, prev := range p.sort[:i] {
+			terms[i].equal = append(terms[i].equal, condition{field: prev.field, op: OpEq, value: p.after[j]})
+		}
+		op := OpGt
+		if s.desc {
+			op = OpLt
+		}
+		terms[i].after = condition{field: s.field, op: op, value: p.after[i]}
+	}
+	return terms
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// convert returns v as a value of type typ. Strings are parsed; numbers are
+// converted between numeric types.
+func convert(v any, typ reflect.Type) (any, error) {
+	if v == nil {
+		return nil, errors.New("missing value")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(typ) {
+		return v, nil
+	}
+	if s, ok := v.(string); ok {
+		if reflect.PointerTo(typ).Implements(textUnmarshaler) {
+			ptr := reflect.New(typ)
+			if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				return nil, fmt.Errorf("invalid value %q", s)
+			}
+			return ptr.Elem().Interface(), nil
+		}
+		out := reflect.New(typ).Elem()
+		var err error
+		switch typ.Kind() {
+		case reflect.String:
+			out.SetString(s)
+		case reflect.Bool:
+			var b bool
+			b, err = strconv.ParseBool(s)
+			out.SetBool(b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var n int64
+			n, err = strconv.ParseInt(s, 10, typ.Bits())
+			out.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			n, err = strconv.ParseUint(s, 10, typ.Bits())
+			out.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			var f float64
+			f, err = strconv.ParseFloat(s, typ.Bits())
+			out.SetFloat(f)
+		default:
+			return nil, fmt.Errorf("cannot compare with %s", typ)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", s)
+		}
+		return out.Interface(), nil
+	}
+	if numeric(rv.Kind()) && numeric(typ.Kind()) {
+		return rv.Convert(typ).Interface(), nil
+	}
+	return nil, fmt.Errorf("%T is not a %s", v, typ)
+}
+
+// convertAll converts the elements of the slice v.
+func convertAll(v any, typ reflect.Type) ([]any, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%T is not a list", v)
+	}
+	if rv.Len() == 0 {
+		return nil, errors.New("empty list")
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		var err error
+		if values[i], err = convert(rv.Index(i).Interface(), typ); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func numeric(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
@@ -0,0 +1,297 @@
+// internal/database/repository_test.go
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseListQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   map[string]string
+		want    ListOptions
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: map[string]string{},
+			want:  ListOptions{Limit: DefaultListLimit},
+		},
+		{
+			name:  "paging",
+			query: map[string]string{"limit": "50", "offset": "100", "total": "true"},
+			want:  ListOptions{Limit: 50, Offset: 100, Total: true},
+		},
+		{
+			name:  "limit capped",
+			query: map[string]string{"limit": "1000"},
+			want:  ListOptions{Limit: MaxListLimit},
+		},
+		{
+			name:  "cursor",
+			query: map[string]string{"cursor": "eyJzIjoiaWQifQ"},
+			want:  ListOptions{Limit: DefaultListLimit, Cursor: "eyJzIjoiaWQifQ"},
+		},
+		{
+			name:  "sort",
+			query: map[string]string{"sort": "-created_at, name"},
+			want: ListOptions{Limit: DefaultListLimit, Sort: []Sort{
+				{Field: "created_at", Desc: true},
+				{Field: "name"},
+			}},
+		},
+		{
+			name:  "equality filter",
+			query: map[string]string{"status": "paid"},
+			want:  ListOptions{Limit: DefaultListLimit, Filters: []Filter{Eq("status", "paid")}},
+		},
+		{
+			name:  "operator filter",
+			query: map[string]string{"price[gte]": "10"},
+			want:  ListOptions{Limit: DefaultListLimit, Filters: []Filter{Gte("price", "10")}},
+		},
+		{
+			name:  "in filter",
+			query: map[string]string{"status[in]": "new,paid"},
+			want:  ListOptions{Limit: DefaultListLimit, Filters: []Filter{{Field: "status", Op: OpIn, Value: []string{"new", "paid"}}}},
+		},
+		{
+			name:  "null filter",
+			query: map[string]string{"deleted_at[null]": "true"},
+			want:  ListOptions{Limit: DefaultListLimit, Filters: []Filter{{Field: "deleted_at", Op: OpNull, Value: "true"}}},
+		},
+		{name: "zero limit", query: map[string]string{"limit": "0"}, wantErr: true},
+		{name: "invalid limit", query: map[string]string{"limit": "ten"}, wantErr: true},
+		{name: "negative offset", query: map[string]string{"offset": "-1"}, wantErr: true},
+		{name: "invalid total", query: map[string]string{"total": "maybe"}, wantErr: true},
+		{name: "empty sort field", query: map[string]string{"sort": "name,,-id"}, wantErr: true},
+		{name: "unknown operator", query: map[string]string{"price[between]": "1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseListQuery(tt.query)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("ParseListQuery() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseListQuery() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseListQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	type status string
+	created := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   any
+		typ     reflect.Type
+		want    any
+		wantErr bool
+	}{
+		{name: "string", value: "ada", typ: reflect.TypeOf(""), want: "ada"},
+		{name: "named string", value: "paid", typ: reflect.TypeOf(status("")), want: status("paid")},
+		{name: "int", value: "-42", typ: reflect.TypeOf(0), want: -42},
+		{name: "uint", value: "42", typ: reflect.TypeOf(uint(0)), want: uint(42)},
+		{name: "float", value: "9.99", typ: reflect.TypeOf(0.0), want: 9.99},
+		{name: "bool", value: "true", typ: reflect.TypeOf(false), want: true},
+		{name: "time", value: "2026-10-18T09:30:00Z", typ: reflect.TypeOf(time.Time{}), want: created},
+		{name: "assignable", value: created, typ: reflect.TypeOf(time.Time{}), want: created},
+		{name: "numeric conversion", value: 3, typ: reflect.TypeOf(int64(0)), want: int64(3)},
+		{name: "float to uint", value: 7.0, typ: reflect.TypeOf(uint(0)), want: uint(7)},
+		{name: "invalid int", value: "1.5", typ: reflect.TypeOf(0), wantErr: true},
+		{name: "int overflow", value: "300", typ: reflect.TypeOf(int8(0)), wantErr: true},
+		{name: "negative uint", value: "-1", typ: reflect.TypeOf(uint(0)), wantErr: true},
+		{name: "invalid bool", value: "yes please", typ: reflect.TypeOf(false), wantErr: true},
+		{name: "invalid time", value: "yesterday", typ: reflect.TypeOf(time.Time{}), wantErr: true},
+		{name: "missing", value: nil, typ: reflect.TypeOf(""), wantErr: true},
+		{name: "not comparable", value: "x", typ: reflect.TypeOf([]byte(nil)), wantErr: true},
+		{name: "mismatched type", value: true, typ: reflect.TypeOf(0), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convert(tt.value, tt.typ)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("convert() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convert() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convert() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertAll(t *testing.T) {
+	got, err := convertAll([]string{"1", "2"}, reflect.TypeOf(uint(0)))
+	if err != nil || !reflect.DeepEqual(got, []any{uint(1), uint(2)}) {
+		t.Errorf("convertAll() = %v, %v", got, err)
+	}
+	for _, v := range []any{[]string{}, "1,2", []string{"1", "x"}} {
+		if _, err := convertAll(v, reflect.TypeOf(uint(0))); err == nil {
+			t.Errorf("convertAll(%#v) succeeded, want an error", v)
+		}
+	}
+}
+
+type listRecord struct {
+	ID        uint
+	Name      string
+	CreatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// listModel describes listRecord the way the GORM and MongoDB repositories
+// describe their types.
+func listModel() *model {
+	field := func(name, goName string, typ reflect.Type, nullable bool) *modelField {
+		return &modelField{name: name, typ: typ, nullable: nullable, value: func(record reflect.Value) any {
+			v := record.FieldByName(goName)
+			if nullable {
+				if v.IsNil() {
+					return nil
+				}
+				v = v.Elem()
+			}
+			return v.Interface()
+		}}
+	}
+	m := &model{fields: map[string]*modelField{
+		"id":         field("id", "ID", reflect.TypeOf(uint(0)), false),
+		"name":       field("name", "Name", reflect.TypeOf(""), false),
+		"created_at": field("created_at", "CreatedAt", reflect.TypeOf(time.Time{}), false),
+		"deleted_at": field("deleted_at", "DeletedAt", reflect.TypeOf(time.Time{}), true),
+	}}
+	m.key = m.fields["id"]
+	return m
+}
+
+func TestListPlan(t *testing.T) {
+	m := listModel()
+
+	p, err := m.plan(ListOptions{
+		Filters: []Filter{Gte("created_at", "2026-01-01T00:00:00Z"), In("id", "1", "2")},
+		Sort:    []Sort{{Field: "name", Desc: true}, {Field: "name"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.limit != DefaultListLimit {
+		t.Errorf("limit = %d, want %d", p.limit, DefaultListLimit)
+	}
+	if got := p.sortSpec(); got != "-name,id" {
+		t.Errorf("sortSpec() = %q, want %q", got, "-name,id")
+	}
+	if got := p.conditions[0].value; got != time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("created_at value = %#v", got)
+	}
+	if got := p.conditions[1].value; !reflect.DeepEqual(got, []any{uint(1), uint(2)}) {
+		t.Errorf("id values = %#v", got)
+	}
+
+	for name, opts := range map[string]ListOptions{
+		"unknown filter field": {Filters: []Filter{Eq("password", "x")}},
+		"unknown sort field":   {Sort: []Sort{{Field: "password"}}},
+		"invalid value":        {Filters: []Filter{Eq("id", "abc")}},
+		"contains on non-text": {Filters: []Filter{Contains("id", "1")}},
+		"cursor and offset":    {Cursor: "x", Offset: 10},
+	} {
+		if _, err := m.plan(opts); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: plan() error = %v, want ErrInvalidQuery", name, err)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	m := listModel()
+	created := time.Date(2026, 10, 18, 9, 30, 0, 123000000, time.UTC)
+	sort := []Sort{{Field: "created_at", Desc: true}}
+
+	p, err := m.plan(ListOptions{Sort: sort, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []listRecord{
+		{ID: 9, Name: "a", CreatedAt: created.Add(time.Hour)},
+		{ID: 7, Name: "b", CreatedAt: created},
+		{ID: 3, Name: "c", CreatedAt: created.Add(-time.Hour)},
+	}
+	page, err := newPage(p, items, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || !page.HasMore || page.NextCursor == "" {
+		t.Fatalf("newPage() = %+v, want 2 items and a cursor", page)
+	}
+
+	next, err := m.plan(ListOptions{Sort: sort, Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{created, uint(7)}; !reflect.DeepEqual(next.after, want) {
+		t.Errorf("after = %#v, want %#v", next.after, want)
+	}
+
+	// created_at < x OR (created_at = x AND id > 7)
+	terms := next.keysetTerms()
+	if len(terms) != 2 ||
+		len(terms[0].equal) != 0 || terms[0].after.op != OpLt || terms[0].after.field.name != "created_at" ||
+		len(terms[1].equal) != 1 || terms[1].equal[0].value != created || terms[1].after.op != OpGt || terms[1].after.value != uint(7) {
+		t.Errorf("keysetTerms() = %+v", terms)
+	}
+
+	last, err := newPage(next, items[2:], nil)
+	if err != nil || last.HasMore || last.NextCursor != "" {
+		t.Errorf("last page = %+v, %v", last, err)
+	}
+
+	for name, opts := range map[string]ListOptions{
+		"other sort":    {Sort: []Sort{{Field: "name"}}, Cursor: page.NextCursor},
+		"not base64":    {Sort: sort, Cursor: "%%%"},
+		"not json":      {Sort: sort, Cursor: base64.RawURLEncoding.EncodeToString([]byte("nope"))},
+		"wrong type":    {Sort: sort, Cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"-created_at,id","v":["x","y"]}`))},
+		"nullable sort": {Sort: []Sort{{Field: "deleted_at"}}, Cursor: page.NextCursor},
+	} {
+		_, err := m.plan(opts)
+		if !errors.Is(err, ErrInvalidQuery) || !strings.Contains(err.Error(), "cursor") {
+			t.Errorf("%s: plan() error = %v, want an invalid cursor", name, err)
+		}
+	}
+}
+
+func TestNewPageWithoutCursor(t *testing.T) {
+	m := listModel()
+	items := []listRecord{{ID: 1}, {ID: 2}}
+
+	for name, opts := range map[string]ListOptions{
+		"offset":        {Limit: 1, Offset: 5},
+		"nullable sort": {Limit: 1, Sort: []Sort{{Field: "deleted_at"}}},
+	} {
+		p, err := m.plan(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := newPage(p, items, nil)
+		if err != nil || !page.HasMore || page.NextCursor != "" || len(page.Items) != 1 {
+			t.Errorf("%s: newPage() = %+v, %v; want more items and no cursor", name, page, err)
+		}
+	}
+}
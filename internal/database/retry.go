@@ -0,0 +1,157 @@
+// internal/database/retry.go
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"gorbit/internal/config"
+)
+
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// RetryError is returned when a datastore could not be opened within its
+// retry policy. It wraps the error of every attempt.
+type RetryError struct {
+	Store    string
+	Attempts int
+	Elapsed  time.Duration
+	Errs     []error
+}
+
+func (e *RetryError) Error() string {
+	// Attempts usually fail the same way; list each distinct error once
+	var (
+		messages []string
+		counts   = make(map[string]int)
+	)
+	for _, err := range e.Errs {
+		msg := err.Error()
+		if counts[msg] == 0 {
+			messages = append(messages, msg)
+		}
+		counts[msg]++
+	}
+	for i, msg := range messages {
+		if n := counts[msg]; n > 1 {
+			messages[i] = fmt.Sprintf("%s (%d times)", msg, n)
+		}
+	}
+	return fmt.Sprintf("gave up after %d attempts in %s: %s",
+		e.Attempts, e.Elapsed.Round(time.Millisecond), strings.Join(messages, "; "))
+}
+
+func (e *RetryError) Unwrap() []error {
+	return e.Errs
+}
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. an invalid setting, so
+// that Retry gives up at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Retry calls open until it succeeds, the attempts of policy are used up,
+// the next wait would pass policy.Timeout, ctx is done, or open returns a
+// Permanent error. Each failed attempt is logged as a warning. The context
+// passed to open ends with policy.Timeout, so that an attempt in progress
+// does not outlast it.
+func Retry[T any](ctx context.Context, name string, policy config.RetryPolicy, open func(ctx context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	attempts := max(policy.MaxAttempts, 1)
+	if policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	var errs []error
+	for attempt := 1; ; attempt++ {
+		v, err := open(ctx)
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("Datastore connected", "store", name, "attempt", attempt)
+			}
+			return v, nil
+		}
+		var zero T
+
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return zero, permanent.err
+		}
+		if attempts == 1 {
+			return zero, err
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			return zero, &RetryError{Store: name, Attempts: attempt, Elapsed: time.Since(start), Errs: errs}
+		}
+
+		delay := Backoff(policy, attempt)
+		if attempt == attempts || (policy.Timeout > 0 && time.Since(start)+delay > policy.Timeout) {
+			return zero, &RetryError{Store: name, Attempts: attempt, Elapsed: time.Since(start), Errs: errs}
+		}
+		slog.Warn("Datastore connection failed",
+			"store", name,
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"retry_in", delay,
+			"error", err,
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			errs = append(errs, ctx.Err())
+			return zero, &RetryError{Store: name, Attempts: attempt, Elapsed: time.Since(start), Errs: errs}
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the wait after the given failed attempt: the initial
+// backoff of policy, doubled for each further attempt up to its maximum,
+// plus or minus its jitter.
+func Backoff(policy config.RetryPolicy, attempt int) time.Duration {
+	initial := policy.InitialBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	limit := policy.MaxBackoff
+	if limit <= 0 {
+		limit = defaultMaxBackoff
+	}
+
+	delay := initial
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+
+	if policy.Jitter > 0 {
+		delay += time.Duration(float64(delay) * policy.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
@@ -0,0 +1,343 @@
+// internal/database/seed.go
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultSeedsDir holds one directory per seed set, e.g. seeds/demo, with
+// one directory of fixtures per datastore, e.g. seeds/demo/postgres.
+const DefaultSeedsDir = "seeds"
+
+// Fixture is the content of one fixture file: the rows of a table or the
+// documents of a collection.
+type Fixture struct {
+	// Name is the table or collection, taken from the file name
+	Name string
+	// Key lists the columns or fields identifying a row; existing rows with
+	// the same key are updated instead of inserted
+	Key  []string
+	Rows []map[string]any
+}
+
+// SeedOptions controls how fixtures are loaded.
+type SeedOptions struct {
+	// Reset empties the seeded tables or collections first
+	Reset bool
+	// Stores limits Registry.Seed to the named stores; all if empty
+	Stores []string
+}
+
+// SeedResult reports the rows loaded into one table or collection.
+type SeedResult struct {
+	Store string
+	Name  string
+	Rows  int
+}
+
+// Seedable is implemented by stores that can load fixtures.
+type Seedable interface {
+	Seed(ctx context.Context, fixtures []Fixture, opts SeedOptions) ([]SeedResult, error)
+}
+
+// LoadFixtures reads the .yaml, .yml and .json fixtures in dir, ordered by
+// file name. A file holds either a list of rows, or a map with the rows
+// under "rows" and the identifying columns under "key". A missing directory
+// has no fixtures.
+func LoadFixtures(dir string) ([]Fixture, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []Fixture
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseFixture(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		f.Name = strings.TrimSuffix(entry.Name(), ext)
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+// parseFixture decodes a fixture file; JSON is read as YAML.
+func parseFixture(data []byte) (Fixture, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return Fixture{}, err
+	}
+
+	var f Fixture
+	rows := raw
+	if doc, ok := raw.(map[string]any); ok {
+		rows = doc["rows"]
+		switch key := doc["key"].(type) {
+		case nil:
+		case string:
+			f.Key = []string{key}
+		case []any:
+			for _, k := range key {
+				s, ok := k.(string)
+				if !ok {
+					return Fixture{}, fmt.Errorf("invalid key %v", k)
+				}
+				f.Key = append(f.Key, s)
+			}
+		default:
+			return Fixture{}, fmt.Errorf("invalid key %v", key)
+		}
+	}
+
+	list, ok := rows.([]any)
+	if !ok && rows != nil {
+		return Fixture{}, errors.New("expected a list of rows")
+	}
+	for i, r := range list {
+		row, ok := r.(map[string]any)
+		if !ok {
+			return Fixture{}, fmt.Errorf("row %d is not a map", i+1)
+		}
+		f.Rows = append(f.Rows, row)
+	}
+	return f, nil
+}
+
+// SeedStore loads the fixtures in dir into store, which is reported as
+// name. Stores without fixtures in dir are left alone.
+func SeedStore(ctx context.Context, name string, store Store, dir string, opts SeedOptions) ([]SeedResult, error) {
+	seedable, ok := store.(Seedable)
+	if !ok {
+		return nil, fmt.Errorf("%s does not support seeding", name)
+	}
+	fixtures, err := LoadFixtures(dir)
+	if err != nil || len(fixtures) == 0 {
+		return nil, err
+	}
+	results, err := seedable.Seed(ctx, fixtures, opts)
+	for i := range results {
+		results[i].Store = name
+	}
+	return results, err
+}
+
+// Seed loads the fixtures of a seed set, e.g. seeds/e2e, into every opened
+// store with a directory in it. With opts.Reset the seeded tables and
+// collections are emptied first, which lets tests start from a known state:
+//
+//	_, err := stores.Seed(ctx, "seeds/e2e", database.SeedOptions{Reset: true})
+func (r *Registry) Seed(ctx context.Context, dir string, opts SeedOptions) ([]SeedResult, error) {
+	var results []SeedResult
+	for _, s := range r.stores {
+		if len(opts.Stores) > 0 && !contains(opts.Stores, s.Name) {
+			continue
+		}
+		if _, ok := s.Store.(Seedable); !ok {
+			continue
+		}
+		seeded, err := SeedStore(ctx, s.Name, s.Store, filepath.Join(dir, s.Name), opts)
+		results = append(results, seeded...)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		if len(seeded) > 0 {
+			slog.Info("Seeded datastore", "store", s.Name, "set", filepath.Base(dir), "tables", len(seeded))
+		}
+	}
+	return results, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Seed loads fixtures in one transaction, parents before the tables
+// referencing them. Rows of fixtures with a key are upserted. On
+// PostgreSQL, id sequences are moved past the seeded ids.
+func (s *SQLStore) Seed(ctx context.Context, fixtures []Fixture, opts SeedOptions) ([]SeedResult, error) {
+	db := s.DB.WithContext(ctx)
+	ordered, err := seedOrder(db, fixtures)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SeedResult
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if opts.Reset {
+			for i := len(ordered) - 1; i >= 0; i-- {
+				if err := tx.Exec("DELETE FROM ?", clause.Table{Name: ordered[i].Name}).Error; err != nil {
+					return fmt.Errorf("reset %s: %w", ordered[i].Name, err)
+				}
+			}
+		}
+
+		for _, f := range ordered {
+			hasID := false
+			for i, row := range f.Rows {
+				values, err := sqlRow(row)
+				if err != nil {
+					return fmt.Errorf("%s row %d: %w", f.Name, i+1, err)
+				}
+				_, ok := values["id"]
+				hasID = hasID || ok
+
+				q := tx.Table(f.Name)
+				if len(f.Key) > 0 {
+					q = q.Clauses(upsertClause(f.Key, values))
+				}
+				if err := q.Create(values).Error; err != nil {
+					return fmt.Errorf("%s row %d: %w", f.Name, i+1, err)
+				}
+			}
+			if hasID && db.Dialector.Name() == "postgres" {
+				err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM ?), false)",
+					f.Name, clause.Table{Name: f.Name}).Error
+				if err != nil {
+					return fmt.Errorf("%s: reset id sequence: %w", f.Name, err)
+				}
+			}
+			results = append(results, SeedResult{Name: f.Name, Rows: len(f.Rows)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func upsertClause(key []string, values map[string]any) clause.OnConflict {
+	onConflict := clause.OnConflict{}
+	for _, k := range key {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: k})
+	}
+	var update []string
+	for col := range values {
+		if !contains(key, col) {
+			update = append(update, col)
+		}
+	}
+	sort.Strings(update)
+	if len(update) == 0 {
+		onConflict.DoNothing = true
+	} else {
+		onConflict.DoUpdates = clause.AssignmentColumns(update)
+	}
+	return onConflict
+}
+
+// sqlRow stores nested maps and lists as JSON text.
+func sqlRow(row map[string]any) (map[string]any, error) {
+	values := make(map[string]any, len(row))
+	for col, v := range row {
+		switch v.(type) {
+		case map[string]any, []any:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", col, err)
+			}
+			v = string(data)
+		}
+		values[col] = v
+	}
+	return values, nil
+}
+
+// seedOrder sorts fixtures so that tables come after the tables their
+// foreign keys reference, keeping the file order otherwise.
+func seedOrder(db *gorm.DB, fixtures []Fixture) ([]Fixture, error) {
+	var query string
+	switch db.Dialector.Name() {
+	case "postgres":
+		query = `SELECT tc.table_name AS child, ccu.table_name AS parent
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.constraint_column_usage ccu
+				ON tc.constraint_name = ccu.constraint_name AND tc.table_schema = ccu.table_schema
+			WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema()`
+	case "mysql":
+		query = `SELECT table_name AS child, referenced_table_name AS parent
+			FROM information_schema.key_column_usage
+			WHERE table_schema = DATABASE() AND referenced_table_name IS NOT NULL`
+	default:
+		return fixtures, nil
+	}
+
+	var refs []struct {
+		Child  string
+		Parent string
+	}
+	if err := db.Raw(query).Scan(&refs).Error; err != nil {
+		return nil, fmt.Errorf("read foreign keys: %w", err)
+	}
+	parents := make(map[string][]string)
+	for _, ref := range refs {
+		if ref.Child != ref.Parent {
+			parents[ref.Child] = append(parents[ref.Child], ref.Parent)
+		}
+	}
+
+	// Repeatedly take the first fixture whose seeded parents are all placed
+	placed := make(map[string]bool)
+	seeded := make(map[string]bool)
+	for _, f := range fixtures {
+		seeded[f.Name] = true
+	}
+	remaining := append([]Fixture(nil), fixtures...)
+	ordered := make([]Fixture, 0, len(fixtures))
+	for len(remaining) > 0 {
+		next := -1
+		for i, f := range remaining {
+			ready := true
+			for _, p := range parents[f.Name] {
+				if seeded[p] && !placed[p] {
+					ready = false
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			names := make([]string, len(remaining))
+			for i, f := range remaining {
+				names[i] = f.Name
+			}
+			return nil, fmt.Errorf("foreign keys between %s form a cycle", strings.Join(names, ", "))
+		}
+		placed[remaining[next].Name] = true
+		ordered = append(ordered, remaining[next])
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+	return ordered, nil
+}
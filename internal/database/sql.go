@@ -0,0 +1,150 @@
+// internal/database/sql.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorbit/internal/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultConnectTimeout bounds the initial ping when connect_timeout
+	// is not set.
+	defaultConnectTimeout = 5 * time.Second
+	// defaultTimezone is the session time zone when timezone is not set.
+	defaultTimezone = "UTC"
+)
+
+// SQLStore adapts a GORM connection to the Store interface.
+type SQLStore struct {
+	DB *gorm.DB
+}
+
+// Ping verifies the underlying connection pool is reachable.
+func (s *SQLStore) Ping(ctx context.Context) error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes the underlying connection pool and those of its replicas.
+func (s *SQLStore) Close(ctx context.Context) error {
+	var errs []error
+	if replicas := replicasOf(s.DB); replicas != nil {
+		errs = append(errs, replicas.close())
+	}
+	sqlDB, err := s.DB.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	return errors.Join(append(errs, err)...)
+}
+
+// SQL returns the GORM connection opened for the named driver.
+func (r *Registry) SQL(name string) (*gorm.DB, bool) {
+	store, ok := r.Get(name)
+	if !ok {
+		return nil, false
+	}
+	sqlStore, ok := store.(*SQLStore)
+	if !ok {
+		return nil, false
+	}
+	return sqlStore.DB, true
+}
+
+// Migrator returns a Migrator for the SQL migrations in dir.
+func (s *SQLStore) Migrator(dir string) (SchemaMigrator, error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(s.DB, migrations)
+}
+
+// openSQL applies the pool settings of c to pool and verifies it within
+// ctx and the connect timeout, then opens GORM over it with dialector,
+// logging through log. Pinging first keeps dialectors that query the
+// server as they open, such as MySQL's, from blocking on an unreachable
+// one. A max_idle_conns of 0 keeps the database/sql default.
+func openSQL(ctx context.Context, name string, pool *sql.DB, dialector gorm.Dialector, c config.SQLDatabase, log *QueryLogger) (*gorm.DB, error) {
+	// pool is closed on failure, so a failed attempt leaves nothing behind
+	// for a retry
+	setPool(pool, c)
+	pingCtx, cancel := context.WithTimeout(ctx, connectTimeout(c))
+	defer cancel()
+
+	if err := pool.PingContext(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("%s ping failed: %w", name, err)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:               log,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("%s connection failed: %w", name, err)
+	}
+	if explainer := log.explainer(pool); explainer != nil {
+		if err := db.Use(explainer); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("%s query plans: %w", name, err)
+		}
+	}
+
+	slog.Info("Database connection established",
+		"store", name,
+		"host", c.Host,
+		"database", c.Database,
+		"sslmode", sslMode(c),
+	)
+	return db, nil
+}
+
+func setPool(sqlDB *sql.DB, c config.SQLDatabase) {
+	sqlDB.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
+
+func connectTimeout(c config.SQLDatabase) time.Duration {
+	if c.ConnectTimeout <= 0 {
+		return defaultConnectTimeout
+	}
+	return c.ConnectTimeout
+}
+
+// closeSQL closes the pool of db, for when its setup fails half way.
+func closeSQL(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+func sslMode(c config.SQLDatabase) string {
+	if c.SSLMode == "" {
+		return "disable"
+	}
+	return c.SSLMode
+}
+
+func timezone(c config.SQLDatabase) string {
+	if c.Timezone == "" {
+		return defaultTimezone
+	}
+	return c.Timezone
+}
@@ -0,0 +1,195 @@
+// internal/database/sql_repository.go
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormRepository is a Repository over the table of T in a SQL store. It
+// joins the transaction of the store carried by the context, see Conn.
+type GormRepository[T any] struct {
+	db    *gorm.DB
+	model func() (*model, error)
+}
+
+// NewGormRepository returns a repository for T, which must be a GORM model
+// with a single primary key.
+func NewGormRepository[T any](db *gorm.DB) *GormRepository[T] {
+	r := &GormRepository[T]{db: db}
+	r.model = sync.OnceValues(r.parse)
+	return r
+}
+
+func (r *GormRepository[T]) parse() (*model, error) {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	sch := stmt.Schema
+	if sch.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("%s has no single primary key", sch.Name)
+	}
+
+	m := &model{fields: make(map[string]*modelField)}
+	for _, f := range sch.Fields {
+		if f.DBName == "" || !f.Readable {
+			continue
+		}
+		mf := &modelField{
+			name:     f.DBName,
+			typ:      f.IndirectFieldType,
+			nullable: f.FieldType.Kind() == reflect.Ptr,
+			value: func(record reflect.Value) any {
+				v, _ := f.ValueOf(context.Background(), record)
+				return v
+			},
+		}
+		m.fields[f.DBName] = mf
+		if f == sch.PrioritizedPrimaryField {
+			m.key = mf
+		}
+	}
+	return m, nil
+}
+
+func (r *GormRepository[T]) Create(ctx context.Context, record *T) error {
+	return Conn(ctx, r.db).Create(record).Error
+}
+
+func (r *GormRepository[T]) Get(ctx context.Context, id string) (*T, error) {
+	query, err := r.byKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	record := new(T)
+	if err := Conn(ctx, r.db).Where(query).Take(record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *GormRepository[T]) Update(ctx context.Context, record *T) error {
+	return Conn(ctx, r.db).Save(record).Error
+}
+
+func (r *GormRepository[T]) Delete(ctx context.Context, id string) error {
+	query, err := r.byKey(id)
+	if err != nil {
+		return err
+	}
+
+	res := Conn(ctx, r.db).Where(query).Delete(new(T))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// byKey returns the condition selecting the record with the given ID; IDs
+// that cannot be a primary key are not found.
+func (r *GormRepository[T]) byKey(id string) (clause.Expression, error) {
+	m, err := r.model()
+	if err != nil {
+		return nil, err
+	}
+	key, err := m.parseKey(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return clause.Eq{Column: gormColumn(m.key), Value: key}, nil
+}
+
+func (r *GormRepository[T]) List(ctx context.Context, opts ListOptions) (Page[T], error) {
+	m, err := r.model()
+	if err != nil {
+		return Page[T]{}, err
+	}
+	p, err := m.plan(opts)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	query := Conn(ctx, r.db).Model(new(T))
+	for _, c := range p.conditions {
+		query = query.Where(gormCondition(c))
+	}
+	var total *int64
+	if p.total {
+		var n int64
+		if err := query.Session(&gorm.Session{}).Count(&n).Error; err != nil {
+			return Page[T]{}, err
+		}
+		total = &n
+	}
+
+	if p.after != nil {
+		var terms []clause.Expression
+		for _, t := range p.keysetTerms() {
+			exprs := []clause.Expression{}
+			for _, c := range t.equal {
+				exprs = append(exprs, gormCondition(c))
+			}
+			terms = append(terms, clause.And(append(exprs, gormCondition(t.after))...))
+		}
+		query = query.Where(clause.Or(terms...))
+	}
+	for _, s := range p.sort {
+		query = query.Order(clause.OrderByColumn{Column: gormColumn(s.field), Desc: s.desc})
+	}
+
+	items := []T{}
+	if err := query.Limit(p.limit + 1).Offset(p.offset).Find(&items).Error; err != nil {
+		return Page[T]{}, err
+	}
+	return newPage(p, items, total)
+}
+
+func gormColumn(f *modelField) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: f.name}
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns; backslash is the
+// default escape character of MySQL and PostgreSQL.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func gormCondition(c condition) clause.Expression {
+	column := gormColumn(c.field)
+	switch c.op {
+	case OpNe:
+		return clause.Neq{Column: column, Value: c.value}
+	case OpGt:
+		return clause.Gt{Column: column, Value: c.value}
+	case OpGte:
+		return clause.Gte{Column: column, Value: c.value}
+	case OpLt:
+		return clause.Lt{Column: column, Value: c.value}
+	case OpLte:
+		return clause.Lte{Column: column, Value: c.value}
+	case OpIn:
+		return clause.IN{Column: column, Values: c.value.([]any)}
+	case OpContains:
+		return clause.Like{Column: column, Value: "%" + likeEscaper.Replace(c.value.(string)) + "%"}
+	case OpNull:
+		if c.value.(bool) {
+			return clause.Eq{Column: column, Value: nil}
+		}
+		return clause.Neq{Column: column, Value: nil}
+	default:
+		return clause.Eq{Column: column, Value: c.value}
+	}
+}
@@ -0,0 +1,158 @@
+// internal/database/tx.go
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gorbit/internal/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTxAttempts is how often RunInTx runs a transaction that keeps
+	// failing with serialization failures or deadlocks.
+	DefaultTxAttempts = 3
+
+	txRetryBackoff    = 20 * time.Millisecond
+	txRetryMaxBackoff = time.Second
+)
+
+// ErrNoTransaction is returned by Savepoint outside a transaction.
+var ErrNoTransaction = errors.New("no transaction in context")
+
+// txKey carries the transaction of the connection pool it was begun on, so
+// that the transactions of several SQL stores do not mix.
+type txKey struct {
+	pool gorm.ConnPool
+}
+
+// WithTx returns a context carrying tx, a transaction begun on db. Conn
+// resolves db to tx in that context.
+func WithTx(ctx context.Context, db, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txKey{db.ConnPool}, tx)
+}
+
+// TxFrom returns the transaction of db carried by ctx, if any.
+func TxFrom(ctx context.Context, db *gorm.DB) (*gorm.DB, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tx, ok := ctx.Value(txKey{db.ConnPool}).(*gorm.DB)
+	return tx, ok
+}
+
+// Conn returns the connection to use for db in ctx: the transaction ctx
+// carries, e.g. the one of a request, or db itself.
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := TxFrom(ctx, db); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// TxOptions configure RunInTx.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxAttempts defaults to DefaultTxAttempts; 1 disables retries
+	MaxAttempts int
+}
+
+// RunInTx runs fn in a transaction of db and commits it if fn returns nil.
+// The context passed to fn carries the transaction, so Conn and the
+// repositories of db use it. When the transaction fails with a
+// serialization failure or a deadlock, fn runs again in a new one after a
+// short backoff; it must not have effects outside the transaction.
+//
+// If ctx carries a transaction of db already, fn runs once in a savepoint
+// of it, see Savepoint: the retry is left to the outer transaction, which
+// the failure aborts too.
+func RunInTx(ctx context.Context, db *gorm.DB, opts TxOptions, fn func(ctx context.Context, tx *gorm.DB) error) error {
+	if _, ok := TxFrom(ctx, db); ok {
+		return Savepoint(ctx, db, fn)
+	}
+
+	attempts := opts.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultTxAttempts
+	}
+	policy := config.RetryPolicy{InitialBackoff: txRetryBackoff, MaxBackoff: txRetryMaxBackoff, Jitter: 0.5}
+	txOpts := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+
+	for attempt := 1; ; attempt++ {
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(WithTx(ctx, db, tx), tx)
+		}, txOpts)
+		if err == nil || attempt >= attempts || !IsRetryable(err) {
+			return err
+		}
+
+		delay := Backoff(policy, attempt)
+		slog.Warn("Transaction conflict, retrying",
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"retry_in", delay,
+			"error", err,
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// savepoints numbers the savepoints so that nested ones do not share a name.
+var savepoints atomic.Uint64
+
+// Savepoint runs fn in a savepoint of the transaction of db carried by ctx.
+// If fn fails, its work is rolled back and the transaction goes on; the
+// error is returned for the caller to handle. A panic is rolled back the
+// same way before it continues.
+func Savepoint(ctx context.Context, db *gorm.DB, fn func(ctx context.Context, tx *gorm.DB) error) (err error) {
+	outer, ok := TxFrom(ctx, db)
+	if !ok {
+		return ErrNoTransaction
+	}
+	tx := outer.WithContext(ctx)
+	name := "gorbit_sp" + strconv.FormatUint(savepoints.Add(1), 10)
+	if err := tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			if rbErr := tx.RollbackTo(name).Error; rbErr != nil {
+				err = errors.Join(err, fmt.Errorf("rollback to savepoint: %w", rbErr))
+			}
+		}
+	}()
+	err = fn(WithTx(ctx, db, outer), outer)
+	panicked = false
+	return err
+}
+
+// IsRetryable reports whether err is a serialization failure or a deadlock,
+// after which the whole transaction can be run again.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, d := range Drivers() {
+		if d.Retryable != nil && d.Retryable(err) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+// internal/lifecycle/lifecycle.go
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// DefaultShutdownTimeout bounds how long in-flight requests may drain.
+	DefaultShutdownTimeout = 15 * time.Second
+	// DefaultCloseTimeout bounds how long a single resource may take to close.
+	DefaultCloseTimeout = 5 * time.Second
+)
+
+type hook struct {
+	name    string
+	timeout time.Duration
+	fn      func(ctx context.Context) error
+}
+
+// Manager runs the HTTP server until SIGINT/SIGTERM and then tears the
+// process down in order: readiness is flipped, requests are drained and the
+// registered resources are closed in reverse registration order.
+type Manager struct {
+	mu      sync.Mutex
+	drain   []func()
+	hooks   []hook
+	signals []os.Signal
+}
+
+// New creates a lifecycle manager trapping SIGINT and SIGTERM.
+func New() *Manager {
+	return &Manager{
+		signals: []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+}
+
+// OnDrain registers a callback run as soon as shutdown starts, before the
+// server stops accepting requests. Use it to fail readiness probes.
+func (m *Manager) OnDrain(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drain = append(m.drain, fn)
+}
+
+// OnShutdown registers a resource to close once the server has drained.
+// Resources are closed in reverse registration order, each bounded by its
+// own timeout (DefaultCloseTimeout when zero).
+func (m *Manager) OnShutdown(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+	if timeout <= 0 {
+		timeout = DefaultCloseTimeout
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, timeout: timeout, fn: fn})
+}
+
+// Serve starts the Fiber app on addr and blocks until a termination signal
+// arrives or the listener fails, then shuts everything down. The returned
+// error reports listener and teardown failures.
+func (m *Manager) Serve(app *fiber.App, addr string, drainTimeout time.Duration) error {
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultShutdownTimeout
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), m.signals...)
+	defer stop()
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(addr)
+	}()
+
+	var errs []error
+	select {
+	case err := <-listenErr:
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server failed: %w", err))
+		}
+	case <-ctx.Done():
+		stop()
+		slog.Info("Shutdown signal received, draining requests", "timeout", drainTimeout)
+		m.runDrain()
+
+		if err := app.ShutdownWithTimeout(drainTimeout); err != nil {
+			slog.Warn("Server did not drain cleanly", "error", err)
+			errs = append(errs, fmt.Errorf("server shutdown: %w", err))
+		} else {
+			slog.Info("Server drained")
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Close runs the registered shutdown hooks in reverse order. It is safe to
+// call more than once; hooks only run the first time.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	hooks := m.hooks
+	m.hooks = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		start := time.Now()
+
+		err := h.run()
+
+		if err != nil {
+			slog.Warn("Failed to close resource",
+				"resource", h.name,
+				"duration", time.Since(start),
+				"error", err,
+			)
+			errs = append(errs, fmt.Errorf("close %s: %w", h.name, err))
+			continue
+		}
+		slog.Info("Closed resource", "resource", h.name, "duration", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) runDrain() {
+	m.mu.Lock()
+	drain := m.drain
+	m.mu.Unlock()
+
+	for _, fn := range drain {
+		fn()
+	}
+}
+
+// run calls the hook and gives up once its timeout expires, even if the
+// hook itself ignores the context.
+func (h hook) run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", h.timeout)
+	}
+}
@@ -2,6 +2,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"gorbit/internal/config"
 	"gorbit/internal/domain"
 	"gorbit/pkg/utils"
@@ -11,8 +12,10 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// JWTProtected creates a middleware for JWT authentication
-func JWTProtected(cfg *config.Config) fiber.Handler {
+// JWTProtected creates a middleware for JWT authentication. The secret is
+// read from the active configuration on every request so it can be rotated
+// with a reload.
+func JWTProtected(store *config.Store) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get authorization header
 		authHeader := c.Get("Authorization")
@@ -37,7 +40,7 @@ func JWTProtected(cfg *config.Config) fiber.Handler {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid signing method")
 			}
-			return []byte(cfg.App.JWTSecret), nil
+			return []byte(store.Config().App.JWTSecret), nil
 		})
 
 		if err != nil {
@@ -83,15 +86,17 @@ func RoleRequired(requiredRole string) fiber.Handler {
 	}
 }
 
-// APIKeyAuth creates middleware for API key authentication
-func APIKeyAuth(cfg *config.Config) fiber.Handler {
+// APIKeyAuth creates middleware for API key authentication. The key is read
+// from the active configuration on every request so it can be rotated with
+// a reload.
+func APIKeyAuth(store *config.Store) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		apiKey := c.Get("X-API-Key")
 		if apiKey == "" {
 			apiKey = c.Query("api_key")
 		}
 
-		if apiKey != cfg.App.APIKey {
+		if expected := store.Config().App.APIKey; expected == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(expected)) != 1 {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   "Unauthorized",
 				"message": "Invalid API key",
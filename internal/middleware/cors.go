@@ -0,0 +1,25 @@
+// internal/middleware/cors.go
+package middleware
+
+import (
+	"strings"
+
+	"gorbit/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// CORS applies the cors.* settings; it is disabled while no origins are
+// allowed and follows configuration reloads.
+func CORS(store *config.Store) fiber.Handler {
+	return Reloadable(store, func(cfg *config.Config) fiber.Handler {
+		if len(cfg.CORS.AllowOrigins) == 0 {
+			return passThrough
+		}
+		return cors.New(cors.Config{
+			AllowOrigins:     strings.Join(cfg.CORS.AllowOrigins, ","),
+			AllowCredentials: cfg.CORS.AllowCredentials,
+		})
+	})
+}
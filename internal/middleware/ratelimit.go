@@ -0,0 +1,39 @@
+// internal/middleware/ratelimit.go
+package middleware
+
+import (
+	"gorbit/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// probePaths are never rate limited so orchestrators can always reach them.
+var probePaths = map[string]bool{
+	"/livez":    true,
+	"/readyz":   true,
+	"/startupz": true,
+}
+
+// RateLimit limits each client IP to rate_limit.max requests per
+// rate_limit.window. Counters restart when a reload changes the limits.
+func RateLimit(store *config.Store) fiber.Handler {
+	return Reloadable(store, func(cfg *config.Config) fiber.Handler {
+		if !cfg.RateLimit.Enabled {
+			return passThrough
+		}
+		return limiter.New(limiter.Config{
+			Next: func(c *fiber.Ctx) bool {
+				return probePaths[c.Path()]
+			},
+			Max:        cfg.RateLimit.Max,
+			Expiration: cfg.RateLimit.Window,
+			LimitReached: func(c *fiber.Ctx) error {
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+					"error":   "Too Many Requests",
+					"message": "Rate limit exceeded",
+				})
+			},
+		})
+	})
+}
@@ -0,0 +1,31 @@
+// internal/middleware/reload.go
+package middleware
+
+import (
+	"sync/atomic"
+
+	"gorbit/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Reloadable builds a handler from the active configuration and rebuilds it
+// whenever the configuration store applies a reload.
+func Reloadable(store *config.Store, build func(cfg *config.Config) fiber.Handler) fiber.Handler {
+	var current atomic.Pointer[fiber.Handler]
+	set := func(cfg *config.Config) {
+		handler := build(cfg)
+		current.Store(&handler)
+	}
+
+	set(store.Config())
+	store.Subscribe(set)
+
+	return func(c *fiber.Ctx) error {
+		return (*current.Load())(c)
+	}
+}
+
+func passThrough(c *fiber.Ctx) error {
+	return c.Next()
+}
@@ -0,0 +1,18 @@
+// internal/middleware/replicas.go
+package middleware
+
+import (
+	"gorbit/internal/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReadYourWrites sends the reads of a request to the primary once it has
+// written through c.UserContext(), so that it never reads a replica that
+// has not caught up with its own writes.
+func ReadYourWrites() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(database.WithReadYourWrites(c.UserContext()))
+		return c.Next()
+	}
+}
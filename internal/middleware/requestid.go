@@ -0,0 +1,42 @@
+// internal/middleware/requestid.go
+package middleware
+
+import (
+	"gorbit/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID identifies each request by the X-Request-ID header it came
+// with, or a new UUID, and echoes it in the response. The ID is stored in
+// the "requestid" local and the user context, see utils.RequestID.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(RequestIDHeader, id)
+		c.Locals("requestid", id)
+		c.SetUserContext(utils.WithRequestID(c.UserContext(), id))
+		return c.Next()
+	}
+}
+
+// validRequestID accepts IDs of up to 128 printable ASCII characters, so
+// that clients cannot inject arbitrary data into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+// internal/middleware/transaction.go
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"gorbit/internal/database"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// TxLocal is the c.Locals key of the request transaction.
+const TxLocal = "tx"
+
+// Transaction runs each request in a transaction of db, a MySQL or
+// PostgreSQL store. The transaction is stored in the "tx" local, see Tx,
+// and in the user context, so that database.Conn and the repositories of db
+// use it. It is committed if the handlers return no error and a 2xx status,
+// and rolled back otherwise. On a panic it is rolled back before the panic
+// goes on to the recover middleware.
+//
+// A request already in a transaction of db runs in it. If the commit fails
+// the response is replaced by a 500, or a 409 when the transaction lost a
+// serialization conflict or deadlock and the client can retry.
+func Transaction(db *gorm.DB, opts ...*sql.TxOptions) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		if _, ok := database.TxFrom(ctx, db); ok {
+			return c.Next()
+		}
+
+		tx := db.WithContext(ctx).Begin(opts...)
+		if tx.Error != nil {
+			slog.Error("Failed to begin request transaction", "path", c.Path(), "error", tx.Error)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "Service Unavailable",
+				"message": "Database unavailable",
+			})
+		}
+		finished := false
+		defer func() {
+			// Only reached unfinished when a handler panics
+			if !finished {
+				rollback(c, tx)
+			}
+		}()
+		c.Locals(TxLocal, tx)
+		c.SetUserContext(database.WithTx(ctx, db, tx))
+
+		err := c.Next()
+		finished = true
+		if status := c.Response().StatusCode(); err != nil || status < 200 || status > 299 {
+			rollback(c, tx)
+			return err
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			if database.IsRetryable(err) {
+				slog.Warn("Request transaction conflict", "path", c.Path(), "error", err)
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":   "Conflict",
+					"message": "Concurrent update, retry the request",
+				})
+			}
+			slog.Error("Failed to commit request transaction", "path", c.Path(), "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Internal Server Error",
+				"message": "Unexpected error",
+			})
+		}
+		return nil
+	}
+}
+
+// Tx returns the transaction of the request, or nil outside Transaction.
+func Tx(c *fiber.Ctx) *gorm.DB {
+	tx, _ := c.Locals(TxLocal).(*gorm.DB)
+	return tx
+}
+
+func rollback(c *fiber.Ctx, tx *gorm.DB) {
+	if err := tx.Rollback().Error; err != nil && !errors.Is(err, sql.ErrTxDone) {
+		slog.Warn("Failed to roll back request transaction", "path", c.Path(), "error", err)
+	}
+}
@@ -0,0 +1,278 @@
+// internal/middleware/transaction_test.go
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+
+	"gorbit/internal/config"
+	"gorbit/internal/database"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// errConflict is reported as a serialization failure by the txtest driver.
+var errConflict = errors.New("serialization failure")
+
+func init() {
+	database.Register(database.Driver{
+		Name:    "txtest",
+		Enabled: func(*config.Config) bool { return false },
+		Open: func(context.Context, *config.Config) (database.Store, error) {
+			return nil, errors.New("not a real store")
+		},
+		Retryable: func(err error) bool { return errors.Is(err, errConflict) },
+	})
+}
+
+// txLog is a database/sql driver that records the statements it runs.
+type txLog struct {
+	mu         sync.Mutex
+	statements []string
+	beginErr   error
+	commitErr  error
+}
+
+func (l *txLog) record(stmt string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.statements = append(l.statements, stmt)
+}
+
+// Statements returns the recorded statements, with savepoint numbers
+// removed.
+func (l *txLog) Statements() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	savepoint := regexp.MustCompile(`gorbit_sp\d+`)
+	statements := make([]string, len(l.statements))
+	for i, stmt := range l.statements {
+		statements[i] = savepoint.ReplaceAllString(stmt, "sp")
+	}
+	return statements
+}
+
+func (l *txLog) Connect(context.Context) (driver.Conn, error) { return &txConn{log: l}, nil }
+func (l *txLog) Driver() driver.Driver                        { return nil }
+
+type txConn struct{ log *txLog }
+
+func (c *txConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *txConn) Close() error                        { return nil }
+func (c *txConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *txConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if c.log.beginErr != nil {
+		return nil, c.log.beginErr
+	}
+	c.log.record("BEGIN")
+	return c, nil
+}
+
+func (c *txConn) Commit() error {
+	c.log.record("COMMIT")
+	return c.log.commitErr
+}
+
+func (c *txConn) Rollback() error {
+	c.log.record("ROLLBACK")
+	return nil
+}
+
+func (c *txConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.log.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+// txDialector is the least of a GORM dialector running on txLog.
+type txDialector struct{ pool *sql.DB }
+
+func (d txDialector) Name() string { return "txtest" }
+
+func (d txDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (d txDialector) Migrator(*gorm.DB) gorm.Migrator                     { return nil }
+func (d txDialector) DataTypeOf(*schema.Field) string                     { return "" }
+func (d txDialector) DefaultValueOf(*schema.Field) clause.Expression      { return clause.Expr{} }
+func (d txDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ any) { w.WriteByte('?') }
+func (d txDialector) QuoteTo(w clause.Writer, s string)                   { w.WriteString(s) }
+func (d txDialector) Explain(sql string, _ ...any) string                 { return sql }
+
+func (d txDialector) SavePoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVEPOINT " + name).Error
+}
+
+func (d txDialector) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+}
+
+func TestTransaction(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name       string
+		beginErr   error
+		commitErr  error
+		handler    func(c *fiber.Ctx, db *gorm.DB) error
+		wantStatus int
+		want       []string
+	}{
+		{
+			name: "commit on 2xx",
+			handler: func(c *fiber.Ctx, db *gorm.DB) error {
+				database.Conn(c.UserContext(), db).Exec("INSERT a")
+				return c.SendStatus(fiber.StatusCreated)
+			},
+			wantStatus: fiber.StatusCreated,
+			want:       []string{"BEGIN", "INSERT a", "COMMIT"},
+		},
+		{
+			name: "rollback on 4xx",
+			handler: func(c *fiber.Ctx, db *gorm.DB) error {
+				database.Conn(c.UserContext(), db).Exec("INSERT a")
+				return c.SendStatus(fiber.StatusUnprocessableEntity)
+			},
+			wantStatus: fiber.StatusUnprocessableEntity,
+			want:       []string{"BEGIN", "INSERT a", "ROLLBACK"},
+		},
+		{
+			name: "rollback on 3xx",
+			handler: func(c *fiber.Ctx, db *gorm.DB) error {
+				Tx(c).Exec("INSERT a")
+				return c.Redirect("/elsewhere")
+			},
+			wantStatus: fiber.StatusFound,
+			want:       []string{"BEGIN", "INSERT a", "ROLLBACK"},
+		},
+		{
+			name: "rollback on error",
+			handler: func(c *fiber.Ctx, db *gorm.DB) error {
+				Tx(c).Exec("INSERT a")
+				return errFailed
+			},
+			wantStatus: fiber.StatusInternalServerError,
+			want:       []string{"BEGIN", "INSERT a", "ROLLBACK"},
+		},
+		{
+			name: "rollback on panic",
+			handler: func(c *fiber.Ctx, db *gorm.DB) error {
+				Tx(c).Exec("INSERT a")
+				panic("handler bug")
+			},
+			wantStatus: fiber.StatusInternalServerError,
+			want:       []string{"BEGIN", "INSERT a", "ROLLBACK"},
+		},
+		{
+			name: "savepoints",
+			handler: func(c *fiber.Ctx, db *gorm.DB) error {
+				ctx := c.UserContext()
+				err := database.Savepoint(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+					tx.Exec("INSERT a")
+					return errFailed
+				})
+				if !errors.Is(err, errFailed) {
+					return err
+				}
+				err = database.RunInTx(ctx, db, database.TxOptions{}, func(ctx context.Context, tx *gorm.DB) error {
+					// Nested savepoints use the same transaction
+					return database.Savepoint(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+						return database.Conn(ctx, db).Exec("INSERT b").Error
+					})
+				})
+				if err != nil {
+					return err
+				}
+				return c.SendStatus(fiber.StatusOK)
+			},
+			wantStatus: fiber.StatusOK,
+			want: []string{
+				"BEGIN",
+				"SAVEPOINT sp", "INSERT a", "ROLLBACK TO SAVEPOINT sp",
+				"SAVEPOINT sp", "SAVEPOINT sp", "INSERT b",
+				"COMMIT",
+			},
+		},
+		{
+			name:       "begin failure",
+			beginErr:   errFailed,
+			handler:    func(c *fiber.Ctx, db *gorm.DB) error { panic("handler called without a transaction") },
+			wantStatus: fiber.StatusServiceUnavailable,
+			want:       []string{},
+		},
+		{
+			name:       "commit conflict",
+			commitErr:  errConflict,
+			handler:    func(c *fiber.Ctx, db *gorm.DB) error { return c.SendStatus(fiber.StatusOK) },
+			wantStatus: fiber.StatusConflict,
+			want:       []string{"BEGIN", "COMMIT"},
+		},
+		{
+			name:       "commit failure",
+			commitErr:  errFailed,
+			handler:    func(c *fiber.Ctx, db *gorm.DB) error { return c.SendStatus(fiber.StatusOK) },
+			wantStatus: fiber.StatusInternalServerError,
+			want:       []string{"BEGIN", "COMMIT"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &txLog{beginErr: tt.beginErr, commitErr: tt.commitErr}
+			pool := sql.OpenDB(log)
+			defer pool.Close()
+			db, err := gorm.Open(txDialector{pool: pool}, &gorm.Config{DisableAutomaticPing: true, SkipDefaultTransaction: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			app := fiber.New()
+			app.Use(recover.New())
+			// Nested Transaction middleware joins the request transaction
+			app.Get("/", Transaction(db), Transaction(db), func(c *fiber.Ctx) error {
+				return tt.handler(c, db)
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := log.Statements(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTxOutsideTransaction(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if Tx(c) != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("app.Test() = %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,58 @@
+// internal/outbox/outbox.go
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorbit/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// Event is a domain event waiting in the outbox_events table to be
+// published.
+type Event struct {
+	ID    uint64 `json:"id" gorm:"primaryKey"`
+	Topic string `json:"topic"`
+	// Key identifies the entity the event is about, e.g. the user ID
+	Key string `json:"key" gorm:"column:event_key"`
+	// Payload is the JSON encoded event
+	Payload string `json:"payload"`
+	// Attempts counts the failed attempts to publish the event
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	AvailableAt time.Time `json:"available_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName keeps GORM in line with the migration.
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+// Enqueue adds an event about key to the outbox of db, with payload
+// encoded as JSON. It is written in the transaction of db carried by ctx,
+// see database.Conn, so that the event is published if and only if that
+// transaction commits: call it within middleware.Transaction or
+// database.RunInTx, next to the write the event reports.
+func Enqueue(ctx context.Context, db *gorm.DB, topic, key string, payload any) error {
+	if topic == "" {
+		return errors.New("outbox: empty topic")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	return database.Conn(ctx, db).Create(&Event{
+		Topic:       topic,
+		Key:         key,
+		Payload:     string(data),
+		AvailableAt: now,
+		CreatedAt:   now,
+	}).Error
+}
@@ -0,0 +1,240 @@
+// internal/outbox/relay.go
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorbit/internal/config"
+	"gorbit/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxErrorLength bounds the last_error column.
+const maxErrorLength = 1024
+
+// Publisher delivers outbox events to a broker.
+type Publisher interface {
+	// Publish delivers e. Delivery is at least once: e is published again
+	// if the outbox cannot be updated afterwards, so consumers should
+	// skip the event IDs they have seen.
+	Publish(ctx context.Context, e Event) error
+	// DeadLetter sets e aside after it could not be published.
+	DeadLetter(ctx context.Context, e Event, cause error) error
+}
+
+// Stats are the metrics of a relay. Counters start at zero when the
+// process starts; Pending and OldestPendingAt are read from the table.
+type Stats struct {
+	Published       uint64     `json:"published"`
+	Failed          uint64     `json:"failed"`
+	DeadLettered    uint64     `json:"dead_lettered"`
+	Pending         int64      `json:"pending"`
+	OldestPendingAt *time.Time `json:"oldest_pending_at,omitempty"`
+	LastPollAt      time.Time  `json:"last_poll_at"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// Relay publishes the events of an outbox table. Batches are claimed with
+// SELECT ... FOR UPDATE SKIP LOCKED, so several instances share the work
+// without publishing an event twice at the same time. Published and
+// dead-lettered events are deleted; failed ones are retried with backoff.
+type Relay struct {
+	db  *gorm.DB
+	pub Publisher
+	cfg config.Outbox
+
+	published    atomic.Uint64
+	failed       atomic.Uint64
+	deadLettered atomic.Uint64
+
+	mu       sync.Mutex
+	lastPoll time.Time
+	lastErr  error
+
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewRelay returns a relay of the outbox of db to pub.
+func NewRelay(db *gorm.DB, pub Publisher, cfg config.Outbox) *Relay {
+	return &Relay{db: db, pub: pub, cfg: cfg}
+}
+
+// Start polls the outbox in the background until Stop. A full batch is
+// followed by the next one at once.
+func (r *Relay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	slog.Info("Outbox relay started",
+		"store", r.cfg.Store,
+		"poll_interval", r.cfg.PollInterval,
+		"batch_size", r.cfg.BatchSize,
+	)
+	go func() {
+		defer close(r.done)
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+			case <-r.stop:
+				return
+			}
+			n, err := r.relay(ctx)
+			r.mu.Lock()
+			r.lastPoll, r.lastErr = time.Now().UTC(), err
+			r.mu.Unlock()
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("Outbox relay failed", "store", r.cfg.Store, "error", err)
+			}
+
+			if err == nil && n == r.cfg.BatchSize {
+				timer.Reset(0)
+			} else {
+				timer.Reset(r.cfg.PollInterval)
+			}
+		}
+	}()
+}
+
+// Stop stops the relay after the batch in progress. If ctx ends first the
+// batch is cancelled; its events are then published again later.
+func (r *Relay) Stop(ctx context.Context) error {
+	if r.stop == nil {
+		return nil
+	}
+	close(r.stop)
+	select {
+	case <-r.done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		return ctx.Err()
+	}
+}
+
+// Check reports the error of the latest poll, for health checks.
+func (r *Relay) Check(context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastErr
+}
+
+// Stats returns the metrics of the relay.
+func (r *Relay) Stats(ctx context.Context) (Stats, error) {
+	stats := Stats{
+		Published:    r.published.Load(),
+		Failed:       r.failed.Load(),
+		DeadLettered: r.deadLettered.Load(),
+	}
+	r.mu.Lock()
+	stats.LastPollAt = r.lastPoll
+	if r.lastErr != nil {
+		stats.LastError = r.lastErr.Error()
+	}
+	r.mu.Unlock()
+
+	var row struct {
+		Pending int64
+		Oldest  *time.Time
+	}
+	err := r.db.WithContext(ctx).Model(&Event{}).
+		Select("COUNT(*) AS pending, MIN(created_at) AS oldest").
+		Scan(&row).Error
+	stats.Pending, stats.OldestPendingAt = row.Pending, row.Oldest
+	return stats, err
+}
+
+// relay publishes one batch of due events and returns its size.
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	var n int
+	err := database.RunInTx(ctx, r.db, database.TxOptions{MaxAttempts: 1}, func(ctx context.Context, tx *gorm.DB) error {
+		var events []Event
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("available_at <= ?", time.Now().UTC()).
+			Order("id").
+			Limit(r.cfg.BatchSize).
+			Find(&events).Error
+		if err != nil {
+			return err
+		}
+		n = len(events)
+
+		for _, e := range events {
+			if err := r.publish(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// publish publishes e and deletes it, or schedules its next attempt. Only
+// failures to update the outbox are returned.
+func (r *Relay) publish(ctx context.Context, tx *gorm.DB, e Event) error {
+	err := r.pub.Publish(ctx, e)
+	if err == nil {
+		r.published.Add(1)
+		return tx.Delete(&Event{}, e.ID).Error
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.failed.Add(1)
+
+	e.Attempts++
+	now := time.Now().UTC()
+	delay := database.Backoff(r.cfg.Retry, e.Attempts)
+	policy := r.cfg.Retry
+	exhausted := e.Attempts >= max(policy.MaxAttempts, 1) ||
+		(policy.Timeout > 0 && now.Add(delay).Sub(e.CreatedAt) > policy.Timeout)
+	if exhausted {
+		dlErr := r.pub.DeadLetter(ctx, e, err)
+		if dlErr == nil {
+			r.deadLettered.Add(1)
+			slog.Error("Outbox event dead-lettered",
+				"id", e.ID,
+				"topic", e.Topic,
+				"attempts", e.Attempts,
+				"error", err,
+			)
+			return tx.Delete(&Event{}, e.ID).Error
+		}
+		err = errors.Join(err, dlErr)
+	}
+
+	slog.Warn("Outbox event publish failed",
+		"id", e.ID,
+		"topic", e.Topic,
+		"attempt", e.Attempts,
+		"retry_in", delay,
+		"error", err,
+	)
+	// Cut on a character boundary: PostgreSQL rejects invalid UTF-8
+	msg := err.Error()
+	if len(msg) > maxErrorLength {
+		msg = msg[:maxErrorLength]
+	}
+	msg = strings.ToValidUTF8(msg, "")
+	return tx.Model(&Event{}).Where("id = ?", e.ID).Updates(map[string]any{
+		"attempts":     e.Attempts,
+		"last_error":   msg,
+		"available_at": now.Add(delay),
+	}).Error
+}
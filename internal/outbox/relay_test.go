@@ -0,0 +1,368 @@
+// internal/outbox/relay_test.go
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"gorbit/internal/config"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// eventTable is an outbox_events table in memory, served through
+// database/sql. It understands the statements of the relay: the claim
+// SELECT, which skips the rows locked by another instance, the DELETE of
+// an event and the UPDATE of a failed one.
+type eventTable struct {
+	mu      sync.Mutex
+	events  map[uint64]Event
+	locked  map[uint64]bool
+	queries []string
+	limits  []int
+}
+
+func newEventTable(events ...Event) *eventTable {
+	t := &eventTable{events: make(map[uint64]Event), locked: make(map[uint64]bool)}
+	for _, e := range events {
+		t.events[e.ID] = e
+	}
+	return t
+}
+
+// IDs returns the IDs of the events left in the table.
+func (t *eventTable) IDs() []uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]uint64, 0, len(t.events))
+	for id := range t.events {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (t *eventTable) Event(id uint64) Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.events[id]
+}
+
+func (t *eventTable) Connect(context.Context) (driver.Conn, error) { return eventConn{t}, nil }
+func (t *eventTable) Driver() driver.Driver                        { return nil }
+
+var (
+	claimQuery  = regexp.MustCompile(`^SELECT \* FROM outbox_events WHERE available_at <= \? ORDER BY id LIMIT \? FOR UPDATE SKIP LOCKED$`)
+	deleteQuery = regexp.MustCompile(`^DELETE FROM outbox_events WHERE outbox_events\.id = \?$`)
+	updateQuery = regexp.MustCompile(`^UPDATE outbox_events SET attempts=\?,available_at=\?,last_error=\? WHERE id = \?$`)
+)
+
+type eventConn struct{ t *eventTable }
+
+func (c eventConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c eventConn) Close() error                        { return nil }
+func (c eventConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c eventConn) Commit() error                       { return nil }
+func (c eventConn) Rollback() error                     { return nil }
+
+func (c eventConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.t.mu.Lock()
+	defer c.t.mu.Unlock()
+	c.t.queries = append(c.t.queries, query)
+
+	if !claimQuery.MatchString(query) {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	now, limit := args[0].Value.(time.Time), int(args[1].Value.(int64))
+	c.t.limits = append(c.t.limits, limit)
+
+	rows := &eventRows{}
+	for _, e := range c.t.events {
+		if !c.t.locked[e.ID] && !e.AvailableAt.After(now) {
+			rows.events = append(rows.events, e)
+		}
+	}
+	sort.Slice(rows.events, func(i, j int) bool { return rows.events[i].ID < rows.events[j].ID })
+	rows.events = rows.events[:min(limit, len(rows.events))]
+	return rows, nil
+}
+
+func (c eventConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.t.mu.Lock()
+	defer c.t.mu.Unlock()
+	c.t.queries = append(c.t.queries, query)
+
+	switch {
+	case deleteQuery.MatchString(query):
+		delete(c.t.events, uint64(args[0].Value.(int64)))
+	case updateQuery.MatchString(query):
+		id := uint64(args[3].Value.(int64))
+		e := c.t.events[id]
+		e.Attempts = int(args[0].Value.(int64))
+		e.AvailableAt = args[1].Value.(time.Time)
+		e.LastError = args[2].Value.(string)
+		c.t.events[id] = e
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type eventRows struct {
+	events []Event
+	next   int
+}
+
+func (r *eventRows) Columns() []string {
+	return []string{"id", "topic", "event_key", "payload", "attempts", "last_error", "available_at", "created_at"}
+}
+
+func (r *eventRows) Close() error { return nil }
+
+func (r *eventRows) Next(dest []driver.Value) error {
+	if r.next == len(r.events) {
+		return io.EOF
+	}
+	e := r.events[r.next]
+	r.next++
+	copy(dest, []driver.Value{int64(e.ID), e.Topic, e.Key, e.Payload, int64(e.Attempts), e.LastError, e.AvailableAt, e.CreatedAt})
+	return nil
+}
+
+// eventDialector is the least of a GORM dialector running on eventTable.
+type eventDialector struct{ pool *sql.DB }
+
+func (d eventDialector) Name() string { return "outboxtest" }
+
+func (d eventDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (d eventDialector) Migrator(*gorm.DB) gorm.Migrator                     { return nil }
+func (d eventDialector) DataTypeOf(*schema.Field) string                     { return "" }
+func (d eventDialector) DefaultValueOf(*schema.Field) clause.Expression      { return clause.Expr{} }
+func (d eventDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ any) { w.WriteByte('?') }
+func (d eventDialector) QuoteTo(w clause.Writer, s string)                   { w.WriteString(s) }
+func (d eventDialector) Explain(sql string, _ ...any) string                 { return sql }
+
+// stubPublisher records the events it publishes or sets aside, and fails
+// to publish those for which fail returns an error.
+type stubPublisher struct {
+	mu            sync.Mutex
+	fail          func(e Event) error
+	deadLetterErr error
+	published     []uint64
+	deadLettered  []Event
+	causes        []error
+}
+
+func (p *stubPublisher) Publish(_ context.Context, e Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail != nil {
+		if err := p.fail(e); err != nil {
+			return err
+		}
+	}
+	p.published = append(p.published, e.ID)
+	return nil
+}
+
+func (p *stubPublisher) DeadLetter(_ context.Context, e Event, cause error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.deadLetterErr != nil {
+		return p.deadLetterErr
+	}
+	p.deadLettered = append(p.deadLettered, e)
+	p.causes = append(p.causes, cause)
+	return nil
+}
+
+func newTestRelay(t *testing.T, table *eventTable, pub Publisher, cfg config.Outbox) *Relay {
+	t.Helper()
+	pool := sql.OpenDB(table)
+	t.Cleanup(func() { pool.Close() })
+	db, err := gorm.Open(eventDialector{pool: pool}, &gorm.Config{DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRelay(db, pub, cfg)
+}
+
+func TestRelayClaimsDueUnlockedEvents(t *testing.T) {
+	now := time.Now().UTC()
+	event := func(id uint64, availableIn time.Duration) Event {
+		return Event{ID: id, Topic: "users", Payload: "{}", AvailableAt: now.Add(availableIn), CreatedAt: now}
+	}
+	table := newEventTable(event(1, 0), event(2, -time.Minute), event(3, 0), event(4, 0), event(5, time.Hour))
+	// Held by the batch of another instance
+	table.locked[3] = true
+
+	pub := &stubPublisher{}
+	r := newTestRelay(t, table, pub, config.Outbox{BatchSize: 2})
+
+	n, err := r.relay(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("first batch = %d, %v; want 2 events", n, err)
+	}
+	if !claimQuery.MatchString(table.queries[0]) || table.limits[0] != 2 {
+		t.Errorf("claim query = %q, limit %d", table.queries[0], table.limits[0])
+	}
+
+	// 3 is locked and 5 not due: a short batch
+	n, err = r.relay(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("second batch = %d, %v; want 1 event", n, err)
+	}
+
+	if want := []uint64{1, 2, 4}; !reflect.DeepEqual(pub.published, want) {
+		t.Errorf("published = %v, want %v", pub.published, want)
+	}
+	if want := []uint64{3, 5}; !reflect.DeepEqual(table.IDs(), want) {
+		t.Errorf("left in the outbox = %v, want %v", table.IDs(), want)
+	}
+	if got := r.published.Load(); got != 3 {
+		t.Errorf("published counter = %d, want 3", got)
+	}
+}
+
+func TestRelayFailedPublish(t *testing.T) {
+	errBroker := errors.New("broker unavailable")
+	errDeadLetter := errors.New("dead letter stream unavailable")
+	retry := config.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute, Timeout: time.Hour}
+
+	tests := []struct {
+		name           string
+		attempts       int
+		age            time.Duration
+		deadLetterErr  error
+		wantAttempts   int
+		wantBackoff    time.Duration
+		wantDeadLetter bool
+		wantError      string
+	}{
+		{
+			name:         "first failure",
+			wantAttempts: 1,
+			wantBackoff:  time.Second,
+			wantError:    "broker unavailable",
+		},
+		{
+			name:         "backoff doubles",
+			attempts:     1,
+			wantAttempts: 2,
+			wantBackoff:  2 * time.Second,
+			wantError:    "broker unavailable",
+		},
+		{
+			name:           "attempts exhausted",
+			attempts:       2,
+			wantAttempts:   3,
+			wantDeadLetter: true,
+		},
+		{
+			name:           "timeout exhausted",
+			age:            time.Hour,
+			wantAttempts:   1,
+			wantDeadLetter: true,
+		},
+		{
+			name:          "dead letter fails",
+			attempts:      2,
+			deadLetterErr: errDeadLetter,
+			wantAttempts:  3,
+			wantBackoff:   4 * time.Second,
+			wantError:     "broker unavailable\ndead letter stream unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now().UTC()
+			table := newEventTable(Event{ID: 7, Topic: "users", Payload: "{}", Attempts: tt.attempts, AvailableAt: now, CreatedAt: now.Add(-tt.age)})
+			pub := &stubPublisher{fail: func(Event) error { return errBroker }, deadLetterErr: tt.deadLetterErr}
+			r := newTestRelay(t, table, pub, config.Outbox{BatchSize: 10, Retry: retry})
+
+			if _, err := r.relay(context.Background()); err != nil {
+				t.Fatalf("relay() error = %v", err)
+			}
+			if r.failed.Load() != 1 {
+				t.Errorf("failed counter = %d, want 1", r.failed.Load())
+			}
+
+			if tt.wantDeadLetter {
+				if len(pub.deadLettered) != 1 || pub.deadLettered[0].Attempts != tt.wantAttempts || !errors.Is(pub.causes[0], errBroker) {
+					t.Fatalf("dead-lettered = %+v, %v", pub.deadLettered, pub.causes)
+				}
+				if len(table.IDs()) != 0 || r.deadLettered.Load() != 1 {
+					t.Errorf("dead-lettered event left in the outbox")
+				}
+				return
+			}
+
+			e := table.Event(7)
+			if e.Attempts != tt.wantAttempts || e.LastError != tt.wantError {
+				t.Errorf("event = %d attempts, last error %q; want %d, %q", e.Attempts, e.LastError, tt.wantAttempts, tt.wantError)
+			}
+			if delay := e.AvailableAt.Sub(now); delay < tt.wantBackoff || delay > tt.wantBackoff+time.Second {
+				t.Errorf("next attempt in %v, want %v", delay, tt.wantBackoff)
+			}
+			if len(pub.deadLettered) != 0 || r.deadLettered.Load() != 0 {
+				t.Errorf("event dead-lettered before its attempts were exhausted")
+			}
+		})
+	}
+}
+
+func TestRelayTruncatesLastError(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{name: "short", msg: "broker unavailable"},
+		{name: "ascii", msg: strings.Repeat("x", 3000)},
+		// The limit falls in the middle of a two byte character
+		{name: "multibyte at the limit", msg: strings.Repeat("x", maxErrorLength-1) + "éé"},
+		{name: "multibyte", msg: strings.Repeat("日本語", 500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now().UTC()
+			table := newEventTable(Event{ID: 1, Topic: "users", Payload: "{}", AvailableAt: now, CreatedAt: now})
+			pub := &stubPublisher{fail: func(Event) error { return errors.New(tt.msg) }}
+			r := newTestRelay(t, table, pub, config.Outbox{BatchSize: 10, Retry: config.RetryPolicy{MaxAttempts: 5}})
+
+			if _, err := r.relay(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			got := table.Event(1).LastError
+			if len(got) > maxErrorLength || !utf8.ValidString(got) || !strings.HasPrefix(tt.msg, got) {
+				t.Fatalf("last_error = %d bytes, valid UTF-8 %v", len(got), utf8.ValidString(got))
+			}
+			if len(tt.msg) <= maxErrorLength && got != tt.msg {
+				t.Errorf("last_error = %q, want it unchanged", got)
+			}
+			if len(tt.msg) > maxErrorLength && len(got) < maxErrorLength-utf8.UTFMax {
+				t.Errorf("last_error cut to %d bytes, want close to %d", len(got), maxErrorLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// internal/server/server.go
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"gorbit/internal/api"
+	"gorbit/internal/api/v1/handlers"
+	"gorbit/internal/cache"
+	"gorbit/internal/config"
+	"gorbit/internal/database"
+	"gorbit/internal/lifecycle"
+	"gorbit/internal/middleware"
+	"gorbit/internal/outbox"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// Run loads the configuration with opts, opens the enabled datastores and
+// serves the API until SIGINT/SIGTERM, then shuts down gracefully. It is
+// shared by cmd/api and `gorbit serve`.
+func Run(opts ...config.Option) error {
+	// Load configuration; the store reloads live settings on file changes
+	cfgStore, err := config.NewStore(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cfg := cfgStore.Config()
+
+	// Initialize logger from the active profile; the level follows reloads
+	logLevel := new(slog.LevelVar)
+	if err := logLevel.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", cfg.Log.Level, err)
+	}
+	cfgStore.Subscribe(func(cfg *config.Config) {
+		if err := logLevel.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+			slog.Warn("Ignoring invalid log level", "level", cfg.Log.Level, "error", err)
+		}
+	})
+	var logHandler slog.Handler
+	if cfg.Log.Format == "json" {
+		logHandler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: logLevel,
+		})
+	} else {
+		logHandler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+			Level: logLevel,
+		})
+	}
+	slog.SetDefault(slog.New(logHandler))
+
+	// Datastore initialization; only stores enabled in configs/ are opened
+	slog.Info("Initializing datastores")
+	stores, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize datastores: %w", err)
+	}
+
+	// Bring SQL schemas up to date before serving traffic
+	if cfg.Databases.MigrateOnStart {
+		if err := stores.Migrate(context.Background(), cfg.Databases.MigrationsDir); err != nil {
+			if closeErr := stores.Close(context.Background()); closeErr != nil {
+				slog.Warn("Failed to close datastores", "error", closeErr)
+			}
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+	}
+
+	// Create health handler with a checker per enabled datastore
+	healthHandler := handlers.NewHealthHandler(cfg)
+	for _, s := range stores.Stores() {
+		healthHandler.Register(handlers.NewHealthChecker(s.Name, s.Critical, 0, s.Store.Ping))
+
+		// Read replicas are reported as their latest background check found
+		// them; reads fall back to the primary, so they are not critical
+		if sqlStore, ok := s.Store.(*database.SQLStore); ok {
+			for _, r := range sqlStore.Replicas() {
+				addr := r.Addr
+				healthHandler.Register(handlers.NewHealthChecker(s.Name+"-replica:"+addr, false, 0, func(context.Context) error {
+					return sqlStore.CheckReplica(addr)
+				}))
+			}
+		}
+	}
+
+	// Shutdown: fail health checks, drain requests, then close datastores
+	// in reverse initialization order
+	lc := lifecycle.New()
+	lc.OnDrain(healthHandler.SetDraining)
+	for _, s := range stores.Stores() {
+		lc.OnShutdown(s.Name, cfg.Server.CloseTimeout, s.Store.Close)
+	}
+
+	// Relay the outbox of a SQL store to Redis Streams; stopped before the
+	// stores close
+	var relay *outbox.Relay
+	if cfg.Outbox.Enabled {
+		if rc, ok := cache.FromRegistry(stores); !ok {
+			slog.Warn("Outbox relay disabled: Redis is not enabled")
+		} else if db, ok := stores.SQL(cfg.Outbox.Store); !ok {
+			slog.Warn("Outbox relay disabled: its store is not enabled", "store", cfg.Outbox.Store)
+		} else {
+			relay = outbox.NewRelay(db, cache.NewStreamPublisher(rc, cfg.Outbox), cfg.Outbox)
+			relay.Start()
+			lc.OnShutdown("outbox relay", cfg.Server.CloseTimeout, relay.Stop)
+			healthHandler.Register(handlers.NewHealthChecker("outbox", false, 0, relay.Check))
+		}
+	}
+
+	// Refresh health checks in the background; stopped before the stores close
+	healthHandler.StartRefresher()
+	lc.OnShutdown("health refresher", cfg.Server.CloseTimeout, healthHandler.StopRefresher)
+
+	if err := cfgStore.Watch(); err != nil {
+		slog.Warn("Configuration hot reload disabled", "error", err)
+	}
+	lc.OnShutdown("config watcher", cfg.Server.CloseTimeout, cfgStore.Close)
+
+	// Fiber app configuration
+	app := fiber.New(fiber.Config{
+		AppName:               cfg.App.Name,
+		ServerHeader:          fmt.Sprintf("%s v%s", cfg.App.Name, cfg.App.Version),
+		DisableStartupMessage: !cfg.Server.Debug,
+	})
+
+	app.Use(middleware.RequestID())
+
+	// Configure middleware based on environment
+	if cfg.Server.Debug {
+		app.Use(logger.New(logger.Config{
+			Format: "[${time}] ${status} - ${latency} ${method} ${path} ${locals:requestid}\n",
+			Output: os.Stdout,
+		}))
+		slog.Debug("Debug mode enabled - using verbose logging")
+	} else {
+		app.Use(logger.New(logger.Config{
+			Format: "${time} | ${status} | ${latency} | ${method} ${path} | ${locals:requestid}\n",
+		}))
+	}
+
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace: cfg.Server.Debug,
+	}))
+
+	app.Use(middleware.CORS(cfgStore))
+	app.Use(middleware.RateLimit(cfgStore))
+	app.Use(middleware.ReadYourWrites())
+
+	// Setup routes
+	api.SetupRouter(app, cfgStore, stores, healthHandler, relay)
+
+	// Report startup complete once the listener is up
+	app.Hooks().OnListen(func(fiber.ListenData) error {
+		healthHandler.MarkStarted()
+		return nil
+	})
+
+	// Start server
+	serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+	slog.Info("Starting server",
+		"address", serverAddr,
+		"version", cfg.App.Version,
+		"environment", cfg.App.Env,
+	)
+
+	if err := lc.Serve(app, serverAddr, cfg.Server.ShutdownTimeout); err != nil {
+		return fmt.Errorf("server stopped with errors: %w", err)
+	}
+	slog.Info("Server stopped")
+	return nil
+}
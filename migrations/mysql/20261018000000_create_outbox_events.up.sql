@@ -0,0 +1,11 @@
+CREATE TABLE outbox_events (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    event_key VARCHAR(255) NOT NULL DEFAULT '',
+    payload LONGTEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1024) NOT NULL DEFAULT '',
+    available_at DATETIME(3) NOT NULL,
+    created_at DATETIME(3) NOT NULL,
+    INDEX idx_outbox_events_available_at (available_at, id)
+);
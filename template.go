@@ -0,0 +1,10 @@
+// Package gorbit embeds the framework sources that `gorbit new` renders
+// into new services.
+package gorbit
+
+import "embed"
+
+// Template holds the project layout copied by `gorbit new`.
+//
+//go:embed cmd internal pkg configs migrations seeds Dockerfile docker-compose.yml Makefile go.mod go.sum
+var Template embed.FS